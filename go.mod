@@ -5,4 +5,8 @@ go 1.20
 require (
 	github.com/golang-jwt/jwt/v4 v4.5.0
 	github.com/google/uuid v1.5.0
+	github.com/lib/pq v1.10.9
+	golang.org/x/net v0.23.0
 )
+
+require golang.org/x/text v0.14.0 // indirect
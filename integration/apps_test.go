@@ -0,0 +1,220 @@
+package integration_test
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/antonio-alexander/go-blog-context/internal/middleware"
+	"github.com/antonio-alexander/go-blog-context/internal/rest_audit"
+	"github.com/antonio-alexander/go-blog-context/internal/rest_context"
+)
+
+type mainFunc func(pwd string, args []string, envs map[string]string, osSignal chan os.Signal) error
+
+func restContextMain(pwd string, args []string, envs map[string]string, osSignal chan os.Signal) error {
+	return rest_context.Main(pwd, args, envs, osSignal)
+}
+
+func restAuditMain(pwd string, args []string, envs map[string]string, osSignal chan os.Signal) error {
+	return rest_audit.Main(pwd, args, envs, osSignal)
+}
+
+// freePort returns a loopback port that's free (at the time it's called)
+func freePort(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return port
+}
+
+// app is an application started (in this process) by startApp
+type app struct {
+	url      string
+	client   *http.Client
+	osSignal chan os.Signal
+	errMain  chan error
+}
+
+// startApp runs main (in the background) on a free port, waitReady
+// waits until it's ready
+func startApp(t *testing.T, main mainFunc, args ...string) *app {
+	t.Helper()
+
+	a := &app{
+		//keep-alives are disabled so the client doesn't hold (or race
+		// to dial) connections that delay the shutdown
+		client:   &http.Client{Transport: &http.Transport{DisableKeepAlives: true}},
+		osSignal: make(chan os.Signal, 1),
+		errMain:  make(chan error, 1),
+	}
+	port := freePort(t)
+	a.url = "http://127.0.0.1:" + port
+	args = append([]string{"-address", "127.0.0.1", "-port", port}, args...)
+	go func() {
+		a.errMain <- main("", args, map[string]string{}, a.osSignal)
+	}()
+	t.Cleanup(func() { a.stop(t) })
+	return a
+}
+
+func (a *app) waitReady(t *testing.T) {
+	t.Helper()
+
+	for tStart := time.Now(); time.Since(tStart) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		select {
+		case err := <-a.errMain:
+			a.errMain = nil
+			t.Fatalf("main returned before it was ready: %v", err)
+		default:
+		}
+		response, err := a.client.Get(a.url + "/readyz")
+		if err != nil {
+			continue
+		}
+		response.Body.Close()
+		if response.StatusCode == http.StatusOK {
+			return
+		}
+	}
+	t.Fatalf("%s wasn't ready", a.url)
+}
+
+// stop signals the application and returns the error of main (it's
+// only stopped once)
+func (a *app) stop(t *testing.T) error {
+	t.Helper()
+
+	if a.errMain == nil {
+		return nil
+	}
+	a.osSignal <- syscall.SIGINT
+	select {
+	case err := <-a.errMain:
+		a.errMain = nil
+		return err
+	case <-time.After(10 * time.Second):
+		t.Fatalf("%s didn't stop", a.url)
+		return nil
+	}
+}
+
+func (a *app) get(t *testing.T, path string) *http.Response {
+	t.Helper()
+
+	response, err := a.client.Get(a.url + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { response.Body.Close() })
+	return response
+}
+
+func TestAppsInOneProcess(t *testing.T) {
+	//both applications (and a second instance of each) are started at
+	// the same time, each must have its own mux for this to work
+	restContext := []*app{startApp(t, restContextMain), startApp(t, restContextMain)}
+	restAudit := []*app{startApp(t, restAuditMain), startApp(t, restAuditMain)}
+	for _, a := range append(restContext, restAudit...) {
+		a.waitReady(t)
+	}
+	for _, a := range restContext {
+		if response := a.get(t, "/ctxvalues"); response.StatusCode != http.StatusOK {
+			t.Fatalf("rest_context: expected %d, got %d", http.StatusOK, response.StatusCode)
+		}
+	}
+	for _, a := range restAudit {
+		//without a token, rest_audit challenges the client
+		response := a.get(t, "/token")
+		if response.StatusCode != http.StatusUnauthorized || response.Header.Get("WWW-Authenticate") == "" {
+			t.Fatalf("rest_audit: expected %d with a challenge, got %d", http.StatusUnauthorized, response.StatusCode)
+		}
+	}
+	for _, a := range append(restContext, restAudit...) {
+		if err := a.stop(t); err != nil {
+			t.Fatalf("%s: unexpected error: %s", a.url, err)
+		}
+	}
+}
+
+func TestAppsLifecycleParity(t *testing.T) {
+	//both applications are run by server.Run, so their lifecycle (the
+	// admin endpoints, the shared middleware and the shutdown) must
+	// behave identically
+	const shutdownBody string = `{"status":"bye"}`
+
+	for name, main := range map[string]mainFunc{
+		"rest_context": restContextMain,
+		"rest_audit":   restAuditMain,
+	} {
+		a := startApp(t, main, "-prestop_delay", "500ms", "-shutdown_body", shutdownBody)
+		a.waitReady(t)
+
+		response := a.get(t, "/inflight")
+		var inflight map[string]int64
+		if err := json.NewDecoder(response.Body).Decode(&inflight); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if _, ok := inflight["inflight"]; !ok || len(inflight) != 1 {
+			t.Fatalf("%s: unexpected /inflight response: %v", name, inflight)
+		}
+		if response.Header.Get(middleware.HeaderRequestId) == "" {
+			t.Fatalf("%s: expected a request id", name)
+		}
+
+		var cfg struct {
+			Config  map[string]any    `json:"config"`
+			Sources map[string]string `json:"sources"`
+		}
+		if err := json.NewDecoder(a.get(t, "/config").Body).Decode(&cfg); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if cfg.Config["prestop_delay"] != "500ms" || cfg.Sources["prestop_delay"] != "flag" {
+			t.Fatalf("%s: unexpected prestop_delay %v (%s)", name, cfg.Config["prestop_delay"], cfg.Sources["prestop_delay"])
+		}
+		if cfg.Config["shutdown_hard_timeout"] != "30s" || cfg.Sources["shutdown_hard_timeout"] != "default" {
+			t.Fatalf("%s: unexpected shutdown_hard_timeout %v (%s)", name, cfg.Config["shutdown_hard_timeout"],
+				cfg.Sources["shutdown_hard_timeout"])
+		}
+
+		//once signalled, the server isn't ready (with the shutdown body)
+		// for the prestop delay and then shuts down cleanly
+		a.osSignal <- syscall.SIGINT
+		for tStart := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+			response := a.get(t, "/readyz")
+			if response.StatusCode == http.StatusServiceUnavailable {
+				body, _ := io.ReadAll(response.Body)
+				if strings.TrimSpace(string(body)) != shutdownBody {
+					t.Fatalf("%s: expected %s, got %s", name, shutdownBody, body)
+				}
+				break
+			}
+			if time.Since(tStart) > time.Second {
+				t.Fatalf("%s: expected to become not ready", name)
+			}
+		}
+		select {
+		case err := <-a.errMain:
+			a.errMain = nil
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %s", name, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: didn't stop", name)
+		}
+	}
+}
@@ -0,0 +1,4 @@
+// Package integration tests the applications together (e.g., running
+// both in the same process) as they're run by cmd, each application's
+// own behavior is tested in its package
+package integration
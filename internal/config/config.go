@@ -0,0 +1,69 @@
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"strings"
+)
+
+const (
+	EventServerConfig string = "server.config"
+	Redacted          string = "[REDACTED]"
+)
+
+const (
+	SourceDefault string = "default"
+	SourceFlag    string = "flag"
+	SourceEnv     string = "env"
+)
+
+type summary struct {
+	Event   string            `json:"event"`
+	Config  map[string]any    `json:"config"`
+	Sources map[string]string `json:"sources,omitempty"`
+}
+
+// Sources returns the source (default, flag or env) of the final value
+// of each flag, the environment overrides the flags. The environment
+// variable of a flag is its upper case name unless it's mapped to a
+// different name (e.g., port:HTTP_PORT)
+func Sources(cli *flag.FlagSet, envs map[string]string, envNames map[string]string) map[string]string {
+	sources := make(map[string]string)
+	cli.VisitAll(func(f *flag.Flag) {
+		sources[f.Name] = SourceDefault
+	})
+	cli.Visit(func(f *flag.Flag) {
+		sources[f.Name] = SourceFlag
+	})
+	cli.VisitAll(func(f *flag.Flag) {
+		envName, ok := envNames[f.Name]
+		if !ok {
+			envName = strings.ToUpper(f.Name)
+		}
+		if _, ok := envs[envName]; ok {
+			sources[f.Name] = SourceEnv
+		}
+	})
+	return sources
+}
+
+// Redact will replace a secret with a placeholder, empty secrets are
+// left empty so it's obvious that the secret wasn't set
+func Redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return Redacted
+}
+
+// WriteSummary writes the resolved configuration (and optionally the
+// source of each setting) as a single json line (event); secrets must
+// be redacted by the caller
+func WriteSummary(writer io.Writer, config map[string]any, sources map[string]string) error {
+	return json.NewEncoder(writer).Encode(&summary{
+		Event:   EventServerConfig,
+		Config:  config,
+		Sources: sources,
+	})
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"reflect"
+	"testing"
+)
+
+func TestWriteSummary(t *testing.T) {
+	var output bytes.Buffer
+	if err := WriteSummary(&output, map[string]any{
+		"port":    "8080",
+		"jwt_key": Redact("secret"),
+		"db_dsn":  Redact(""),
+	}, map[string]string{"port": SourceFlag}); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Count(output.Bytes(), []byte("\n")) != 1 {
+		t.Fatalf("expected a single line, got %q", output.String())
+	}
+	var event struct {
+		Event   string            `json:"event"`
+		Config  map[string]any    `json:"config"`
+		Sources map[string]string `json:"sources"`
+	}
+	if err := json.Unmarshal(output.Bytes(), &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Event != EventServerConfig {
+		t.Fatalf("expected %q, got %q", EventServerConfig, event.Event)
+	}
+	//empty secrets are left empty so it's obvious they weren't set
+	if event.Config["jwt_key"] != Redacted || event.Config["db_dsn"] != "" {
+		t.Fatalf("unexpected secrets: %v", event.Config)
+	}
+	if event.Config["port"] != "8080" || event.Sources["port"] != SourceFlag {
+		t.Fatalf("unexpected port: %v (%s)", event.Config["port"], event.Sources["port"])
+	}
+}
+
+func TestSources(t *testing.T) {
+	cli := flag.NewFlagSet("", flag.ContinueOnError)
+	cli.String("port", "8080", "")
+	cli.String("address", "", "")
+	cli.String("jwt_key", "", "")
+	cli.String("other", "", "")
+	if err := cli.Parse([]string{"-address", "127.0.0.1", "-jwt_key", "key"}); err != nil {
+		t.Fatal(err)
+	}
+	//the environment overrides the flags, the environment variable is
+	// the upper case flag name unless it's mapped
+	sources := Sources(cli, map[string]string{"HTTP_PORT": "9090", "JWT_KEY": "key", "PORT": "ignored"},
+		map[string]string{"port": "HTTP_PORT"})
+	expected := map[string]string{
+		"port":    SourceEnv,
+		"address": SourceFlag,
+		"jwt_key": SourceEnv,
+		"other":   SourceDefault,
+	}
+	if !reflect.DeepEqual(sources, expected) {
+		t.Fatalf("expected %v, got %v", expected, sources)
+	}
+}
@@ -0,0 +1,147 @@
+// Package ctxkeys is the registry of the context keys shared by the
+// applications. Each key is an unexported (empty) struct type, keys are
+// compared by type and value so no other package can create a key that
+// collides with these (as opposed to string keys where any package using
+// the same string would collide). Values can only be stored/retrieved
+// using the functions in this package
+package ctxkeys
+
+import (
+	"context"
+	"time"
+)
+
+type (
+	keyRequestId struct{}
+	keyClaims    struct{}
+	keyUser      struct{}
+	keyTimeout   struct{}
+	keyRequest   struct{}
+	keyKid       struct{}
+	keyShutdown  struct{}
+	keySampled   struct{}
+	keyProto     struct{}
+	keyTimings   struct{}
+)
+
+func WithRequestId(ctx context.Context, requestId string) context.Context {
+	return context.WithValue(ctx, keyRequestId{}, requestId)
+}
+
+func RequestId(ctx context.Context) string {
+	requestId, _ := ctx.Value(keyRequestId{}).(string)
+	return requestId
+}
+
+// Identity is implemented by the (validated) claims stored in the
+// context, it's used by the individual accessors
+type Identity interface {
+	GetId() string
+	GetUserId() string
+}
+
+// WithClaims stores the validated claims, the claims should be stored
+// by value so they can't be modified once stored
+func WithClaims(ctx context.Context, claims Identity) context.Context {
+	return context.WithValue(ctx, keyClaims{}, claims)
+}
+
+// Claims returns the stored claims, if they're not present, nil
+// is returned
+func Claims(ctx context.Context) Identity {
+	claims, _ := ctx.Value(keyClaims{}).(Identity)
+	return claims
+}
+
+func UserId(ctx context.Context) string {
+	if claims := Claims(ctx); claims != nil {
+		return claims.GetUserId()
+	}
+	return ""
+}
+
+func Id(ctx context.Context) string {
+	if claims := Claims(ctx); claims != nil {
+		return claims.GetId()
+	}
+	return ""
+}
+
+// WithUser stores the domain object (e.g., a user) mapped from
+// the claims
+func WithUser(ctx context.Context, user any) context.Context {
+	return context.WithValue(ctx, keyUser{}, user)
+}
+
+func User(ctx context.Context) any {
+	return ctx.Value(keyUser{})
+}
+
+func WithKid(ctx context.Context, kid string) context.Context {
+	return context.WithValue(ctx, keyKid{}, kid)
+}
+
+func Kid(ctx context.Context) string {
+	kid, _ := ctx.Value(keyKid{}).(string)
+	return kid
+}
+
+// RequestInfo describes the request being handled
+type RequestInfo struct {
+	Method string
+	Path   string
+	Query  string
+}
+
+func WithRequest(ctx context.Context, request RequestInfo) context.Context {
+	return context.WithValue(ctx, keyRequest{}, request)
+}
+
+func Request(ctx context.Context) RequestInfo {
+	request, _ := ctx.Value(keyRequest{}).(RequestInfo)
+	return request
+}
+
+// WithDefaultTimeout stores the default timeout of the route
+func WithDefaultTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, keyTimeout{}, timeout)
+}
+
+func DefaultTimeout(ctx context.Context) (time.Duration, bool) {
+	timeout, ok := ctx.Value(keyTimeout{}).(time.Duration)
+	return timeout, ok
+}
+
+// WithShutdown stores a channel that's closed when the server begins
+// shutting down
+func WithShutdown(ctx context.Context, shutdown <-chan struct{}) context.Context {
+	return context.WithValue(ctx, keyShutdown{}, shutdown)
+}
+
+// Shutdown returns the shutdown channel, if it's not present, a nil
+// channel is returned (it will block forever)
+func Shutdown(ctx context.Context) <-chan struct{} {
+	shutdown, _ := ctx.Value(keyShutdown{}).(<-chan struct{})
+	return shutdown
+}
+
+// WithSampled marks the context as sampled (i.e., verbose logging
+// is enabled for the request)
+func WithSampled(ctx context.Context) context.Context {
+	return context.WithValue(ctx, keySampled{}, true)
+}
+
+func IsSampled(ctx context.Context) bool {
+	sampled, _ := ctx.Value(keySampled{}).(bool)
+	return sampled
+}
+
+// WithProto stores the protocol (e.g., HTTP/2.0) of the request
+func WithProto(ctx context.Context, proto string) context.Context {
+	return context.WithValue(ctx, keyProto{}, proto)
+}
+
+func Proto(ctx context.Context) string {
+	proto, _ := ctx.Value(keyProto{}).(string)
+	return proto
+}
@@ -0,0 +1,32 @@
+package ctxkeys
+
+import (
+	"context"
+	"testing"
+)
+
+func TestKeysDontCollide(t *testing.T) {
+	//two packages using the same string key overwrite each other's value
+	type stringKey string
+	ctx := context.WithValue(context.Background(), stringKey("request_id"), "a")
+	ctx = context.WithValue(ctx, stringKey("request_id"), "b")
+	if value := ctx.Value(stringKey("request_id")); value != "b" {
+		t.Fatalf("expected the string keys to collide, got %v", value)
+	}
+
+	//a key with the same name and underlying type declared elsewhere
+	// is a different type so it doesn't collide with the registered key
+	type keyRequestId struct{}
+	ctx = WithRequestId(context.Background(), "request-id")
+	ctx = context.WithValue(ctx, keyRequestId{}, "other")
+	ctx = context.WithValue(ctx, stringKey("request_id"), "string")
+	if requestId := RequestId(ctx); requestId != "request-id" {
+		t.Fatalf("expected %q, got %q", "request-id", requestId)
+	}
+
+	//each registered key is distinct
+	ctx = WithKid(WithProto(ctx, "HTTP/1.1"), "kid")
+	if RequestId(ctx) != "request-id" || Kid(ctx) != "kid" || Proto(ctx) != "HTTP/1.1" {
+		t.Fatalf("unexpected values: %q, %q, %q", RequestId(ctx), Kid(ctx), Proto(ctx))
+	}
+}
@@ -0,0 +1,52 @@
+package ctxkeys
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Timing is the duration of a phase of a request
+type Timing struct {
+	Name     string
+	Duration time.Duration
+}
+
+// ServerTimings accumulates the duration of the phases of a request
+// (e.g., for the Server-Timing header), it's safe for concurrent use
+type ServerTimings struct {
+	mutex  sync.Mutex
+	phases []Timing
+}
+
+// Add records the duration of the phase, it's a no-op if the timings
+// are nil (i.e., they weren't stored in the context)
+func (s *ServerTimings) Add(name string, duration time.Duration) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.phases = append(s.phases, Timing{Name: name, Duration: duration})
+}
+
+// Phases returns a copy of the phases in the order they were added
+func (s *ServerTimings) Phases() []Timing {
+	if s == nil {
+		return nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]Timing(nil), s.phases...)
+}
+
+func WithTimings(ctx context.Context, timings *ServerTimings) context.Context {
+	return context.WithValue(ctx, keyTimings{}, timings)
+}
+
+func Timings(ctx context.Context) *ServerTimings {
+	timings, _ := ctx.Value(keyTimings{}).(*ServerTimings)
+	return timings
+}
@@ -0,0 +1,77 @@
+package echo
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/antonio-alexander/go-blog-context/internal/config"
+	"github.com/antonio-alexander/go-blog-context/internal/ctxkeys"
+	"github.com/antonio-alexander/go-blog-context/internal/response"
+)
+
+// DefaultHeaders are the headers reflected by default, they don't
+// include cookies or credentials
+const DefaultHeaders string = "Accept,Accept-Encoding,Accept-Language,Content-Length,Content-Type,User-Agent,X-Forwarded-For,X-Forwarded-Proto,X-Request-Id"
+
+var redactedHeaders = []string{"Authorization", "Proxy-Authorization"}
+
+type Response struct {
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers"`
+	Values  map[string]string `json:"values"`
+}
+
+// ParseHeaders will parse a comma separated list of header names
+func ParseHeaders(s string) []string {
+	var headers []string
+
+	for _, header := range strings.Split(s, ",") {
+		if header = strings.TrimSpace(header); header != "" {
+			headers = append(headers, http.CanonicalHeaderKey(header))
+		}
+	}
+	return headers
+}
+
+// FilterHeaders returns the headers that are on the whitelist, headers
+// with credentials are redacted even if they're on the whitelist
+func FilterHeaders(header http.Header, whitelist []string) map[string]string {
+	headers := make(map[string]string)
+	for _, key := range whitelist {
+		if _, ok := header[key]; ok {
+			headers[key] = header.Get(key)
+		}
+	}
+	for _, key := range redactedHeaders {
+		if _, ok := headers[key]; ok {
+			headers[key] = config.Redacted
+		}
+	}
+	return headers
+}
+
+// Handler reflects the request (and the values middleware stored in its
+// context) back to the client; it's useful to verify that middleware
+// populated the context as expected. Only the whitelisted headers are
+// reflected
+func Handler(whitelist []string) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		echoed := &Response{
+			Method:  request.Method,
+			Path:    request.URL.Path,
+			Headers: FilterHeaders(request.Header, whitelist),
+			Values:  make(map[string]string),
+		}
+		if requestId := ctxkeys.RequestId(request.Context()); requestId != "" {
+			echoed.Values["request_id"] = requestId
+		}
+		if userId := ctxkeys.UserId(request.Context()); userId != "" {
+			echoed.Values["user_id"] = userId
+		}
+		if err := response.NewEncoder(writer, request).Encode(echoed); err != nil {
+			fmt.Printf("error: %s\n", err.Error())
+		}
+	}
+}
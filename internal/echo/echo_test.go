@@ -0,0 +1,74 @@
+package echo
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/antonio-alexander/go-blog-context/internal/config"
+	"github.com/antonio-alexander/go-blog-context/internal/ctxkeys"
+)
+
+type identity struct{ id, userId string }
+
+func (i identity) GetId() string     { return i.id }
+func (i identity) GetUserId() string { return i.userId }
+
+func TestHandler(t *testing.T) {
+	whitelist := ParseHeaders(DefaultHeaders + ", authorization")
+	request := httptest.NewRequest(http.MethodPost, "/echo", nil)
+	request.Header.Set("Authorization", "Bearer token")
+	request.Header.Set("Cookie", "jwt=token")
+	request.Header.Set("User-Agent", "test")
+	ctx := ctxkeys.WithRequestId(request.Context(), "request-id")
+	ctx = ctxkeys.WithClaims(ctx, identity{id: "id", userId: "user-id"})
+	recorder := httptest.NewRecorder()
+	Handler(whitelist)(recorder, request.WithContext(ctx))
+
+	var echoed Response
+	if err := json.NewDecoder(recorder.Body).Decode(&echoed); err != nil {
+		t.Fatal(err)
+	}
+	if echoed.Method != http.MethodPost || echoed.Path != "/echo" {
+		t.Fatalf("unexpected method/path: %s %s", echoed.Method, echoed.Path)
+	}
+	//the injected context values are reflected
+	if echoed.Values["request_id"] != "request-id" || echoed.Values["user_id"] != "user-id" {
+		t.Fatalf("unexpected values: %v", echoed.Values)
+	}
+	//credentials are redacted (even if whitelisted) and headers that
+	// aren't whitelisted aren't reflected
+	if echoed.Headers["Authorization"] != config.Redacted {
+		t.Fatalf("expected authorization to be redacted, got %q", echoed.Headers["Authorization"])
+	}
+	if _, ok := echoed.Headers["Cookie"]; ok {
+		t.Fatal("expected the cookie not to be reflected")
+	}
+	if echoed.Headers["User-Agent"] != "test" {
+		t.Fatalf("expected the user agent, got %q", echoed.Headers["User-Agent"])
+	}
+}
+
+func TestFilterHeaders(t *testing.T) {
+	whitelist := ParseHeaders(" x-custom ,, user-agent")
+	if len(whitelist) != 2 || whitelist[0] != "X-Custom" || whitelist[1] != "User-Agent" {
+		t.Fatalf("unexpected whitelist: %v", whitelist)
+	}
+	header := http.Header{}
+	header.Set("X-Custom", "custom")
+	header.Set("User-Agent", "test")
+	header.Set("Cookie", "jwt=token")
+	header.Set("X-Other", "other")
+	headers := FilterHeaders(header, whitelist)
+	if len(headers) != 2 || headers["X-Custom"] != "custom" || headers["User-Agent"] != "test" {
+		t.Fatalf("expected only the whitelisted headers, got %v", headers)
+	}
+	//the default whitelist doesn't include cookies or credentials
+	header.Set("Authorization", "Bearer token")
+	for key := range FilterHeaders(header, ParseHeaders(DefaultHeaders)) {
+		if key == "Cookie" || key == "Authorization" || key == "X-Other" {
+			t.Fatalf("expected %s to be omitted by default", key)
+		}
+	}
+}
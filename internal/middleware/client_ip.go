@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIP resolves the ip address of the client, the X-Forwarded-For
+// header is only used if the request was made by a trusted proxy, in
+// which case the right-most address that isn't a trusted proxy is used
+// (addresses to the left of it could've been set by the client)
+func ClientIP(request *http.Request, trustedProxies []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		host = request.RemoteAddr
+	}
+	if !isTrustedProxy(request.RemoteAddr, trustedProxies) {
+		return host
+	}
+	forwardedFor := strings.Split(strings.Join(request.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwardedFor) - 1; i >= 0; i-- {
+		address := strings.TrimSpace(forwardedFor[i])
+		if address == "" {
+			continue
+		}
+		if !isTrustedProxy(address, trustedProxies) {
+			return address
+		}
+		host = address
+	}
+	return host
+}
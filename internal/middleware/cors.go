@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+)
+
+// CORS allows requests from the origins (comma separated, * allows any
+// origin) to be made by a browser (e.g., the demo ui of rest_context
+// calling rest_audit), preflight requests are answered without calling
+// the handler. If there are no origins, cross-origin requests aren't
+// allowed
+func CORS(origins string) Middleware {
+	allowed := make(map[string]bool)
+	for _, origin := range strings.Split(origins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			allowed[origin] = true
+		}
+	}
+	return func(next http.Handler) http.Handler {
+		if len(allowed) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Add("Vary", "Origin")
+			origin := request.Header.Get("Origin")
+			if origin == "" || (!allowed["*"] && !allowed[origin]) {
+				next.ServeHTTP(writer, request)
+				return
+			}
+			writer.Header().Set("Access-Control-Allow-Origin", origin)
+			writer.Header().Set("Access-Control-Expose-Headers", "*")
+			if request.Method == http.MethodOptions && request.Header.Get("Access-Control-Request-Method") != "" {
+				writer.Header().Set("Access-Control-Allow-Methods", "GET, POST")
+				writer.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+				writer.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(writer, request)
+		})
+	}
+}
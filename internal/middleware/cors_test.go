@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	ok := http.HandlerFunc(func(writer http.ResponseWriter, _ *http.Request) {
+		writer.WriteHeader(http.StatusOK)
+	})
+	for name, c := range map[string]struct {
+		origins   string
+		origin    string
+		preflight bool
+		allowed   bool
+		status    int
+	}{
+		"disabled":       {origin: "http://localhost:8080", status: http.StatusOK},
+		"allowed":        {origins: "http://localhost:8080", origin: "http://localhost:8080", allowed: true, status: http.StatusOK},
+		"not_allowed":    {origins: "http://localhost:8080", origin: "http://example.com", status: http.StatusOK},
+		"any":            {origins: "*", origin: "http://example.com", allowed: true, status: http.StatusOK},
+		"no_origin":      {origins: "*", status: http.StatusOK},
+		"preflight":      {origins: "http://a, http://b", origin: "http://b", preflight: true, allowed: true, status: http.StatusNoContent},
+		"preflight_deny": {origins: "http://a", origin: "http://b", preflight: true, status: http.StatusOK},
+	} {
+		request := httptest.NewRequest(http.MethodGet, "/token", nil)
+		if c.preflight {
+			request = httptest.NewRequest(http.MethodOptions, "/token", nil)
+			request.Header.Set("Access-Control-Request-Method", http.MethodGet)
+		}
+		if c.origin != "" {
+			request.Header.Set("Origin", c.origin)
+		}
+		recorder := httptest.NewRecorder()
+		CORS(c.origins)(ok).ServeHTTP(recorder, request)
+		if recorder.Code != c.status {
+			t.Fatalf("%s: expected %d, got %d", name, c.status, recorder.Code)
+		}
+		allowOrigin := recorder.Header().Get("Access-Control-Allow-Origin")
+		if c.allowed && allowOrigin != c.origin {
+			t.Fatalf("%s: expected the origin %q to be allowed, got %q", name, c.origin, allowOrigin)
+		}
+		if !c.allowed && allowOrigin != "" {
+			t.Fatalf("%s: expected the origin not to be allowed, got %q", name, allowOrigin)
+		}
+		if allowHeaders := recorder.Header().Get("Access-Control-Allow-Headers"); c.preflight && c.allowed && allowHeaders == "" {
+			t.Fatalf("%s: expected the authorization header to be allowed", name)
+		}
+	}
+}
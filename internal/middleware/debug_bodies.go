@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/antonio-alexander/go-blog-context/internal/config"
+	"github.com/antonio-alexander/go-blog-context/internal/ctxkeys"
+)
+
+// limitedBuffer buffers up to limit bytes, anything beyond the limit is
+// discarded (but reported as written so it doesn't interrupt the writer)
+type limitedBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (l *limitedBuffer) Write(p []byte) (int, error) {
+	if remaining := l.limit - l.Len(); len(p) > remaining {
+		l.truncated = true
+		if remaining > 0 {
+			l.Buffer.Write(p[:remaining])
+		}
+		return len(p), nil
+	}
+	return l.Buffer.Write(p)
+}
+
+func (l *limitedBuffer) String() string {
+	if l.truncated {
+		return l.Buffer.String() + "...(truncated)"
+	}
+	return l.Buffer.String()
+}
+
+type bodyRecorder struct {
+	http.ResponseWriter
+	body       *limitedBuffer
+	statusCode int
+}
+
+func (b *bodyRecorder) WriteHeader(statusCode int) {
+	b.statusCode = statusCode
+	b.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (b *bodyRecorder) Write(p []byte) (int, error) {
+	n, err := b.ResponseWriter.Write(p)
+	_, _ = b.body.Write(p[:n])
+	return n, err
+}
+
+func (b *bodyRecorder) Unwrap() http.ResponseWriter {
+	return b.ResponseWriter
+}
+
+func (b *bodyRecorder) Flush() {
+	if flusher, ok := b.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// DebugBodies logs the (truncated) request and response bodies, the request
+// body is copied as the handler reads it and the response body as it's
+// written so neither is modified. The authorization and cookie headers
+// (the jwt can be sent in a cookie) are redacted. If not enabled, only
+// the bodies of sampled requests are logged
+func DebugBodies(enabled bool, limit int) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if !enabled && !ctxkeys.IsSampled(request.Context()) {
+				next.ServeHTTP(writer, request)
+				return
+			}
+			requestBody := &limitedBuffer{limit: limit}
+			request.Body = struct {
+				io.Reader
+				io.Closer
+			}{
+				Reader: io.TeeReader(request.Body, requestBody),
+				Closer: request.Body,
+			}
+			recorder := &bodyRecorder{
+				ResponseWriter: writer,
+				body:           &limitedBuffer{limit: limit},
+				statusCode:     http.StatusOK,
+			}
+			next.ServeHTTP(recorder, request)
+			headers := request.Header.Clone()
+			for _, key := range []string{"Authorization", "Proxy-Authorization", "Cookie"} {
+				if headers.Get(key) != "" {
+					headers.Set(key, config.Redacted)
+				}
+			}
+			fmt.Printf("debug: %s %s; headers: %v; request: %q; status: %d; response: %q\n",
+				request.Method, request.URL.Path, headers, requestBody, recorder.statusCode, recorder.body)
+		})
+	}
+}
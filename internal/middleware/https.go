@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/antonio-alexander/go-blog-context/internal/response"
+)
+
+const (
+	HTTPSModeDisabled string = ""
+	HTTPSModeRedirect string = "redirect"
+	HTTPSModeReject   string = "reject"
+)
+
+// ParseTrustedProxies will parse a comma separated list of ip addresses
+// and/or cidrs (e.g., 10.0.0.1,172.16.0.0/12)
+func ParseTrustedProxies(s string) ([]*net.IPNet, error) {
+	var trustedProxies []*net.IPNet
+
+	for _, proxy := range strings.Split(s, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy: %s", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			trustedProxies = append(trustedProxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy: %s", proxy)
+		}
+		trustedProxies = append(trustedProxies, ipNet)
+	}
+	return trustedProxies, nil
+}
+
+func isTrustedProxy(remoteAddr string, trustedProxies []*net.IPNet) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, trustedProxy := range trustedProxies {
+		if trustedProxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// isHTTPS will return true if the request was made over tls, the
+// X-Forwarded-Proto header is only used if the request was made
+// by a trusted proxy (otherwise anyone could set it)
+func isHTTPS(request *http.Request, trustedProxies []*net.IPNet) bool {
+	if request.TLS != nil {
+		return true
+	}
+	if !isTrustedProxy(request.RemoteAddr, trustedProxies) {
+		return false
+	}
+	return strings.EqualFold(request.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// HTTPSOnly will either redirect (308) or reject (400) requests that
+// weren't made over https, depending on the mode; requests for the
+// exempt paths (e.g., probes of the admin endpoints) are always served
+func HTTPSOnly(mode string, trustedProxies []*net.IPNet, exempt ...string) (Middleware, error) {
+	switch mode {
+	default:
+		return nil, fmt.Errorf("unsupported https mode: %s", mode)
+	case HTTPSModeDisabled:
+		return func(next http.Handler) http.Handler { return next }, nil
+	case HTTPSModeRedirect, HTTPSModeReject:
+	}
+	exemptPaths := make(map[string]bool, len(exempt))
+	for _, path := range exempt {
+		exemptPaths[path] = true
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if exemptPaths[request.URL.Path] || isHTTPS(request, trustedProxies) {
+				next.ServeHTTP(writer, request)
+				return
+			}
+			if mode == HTTPSModeRedirect {
+				http.Redirect(writer, request, "https://"+request.Host+request.URL.RequestURI(),
+					http.StatusPermanentRedirect)
+				return
+			}
+			response.WriteError(writer, http.StatusBadRequest, response.CodeBadRequest, errors.New("https required"))
+		})
+	}, nil
+}
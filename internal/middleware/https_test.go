@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPSOnly(t *testing.T) {
+	trustedProxies, err := ParseTrustedProxies("10.0.0.1,172.16.0.0/12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok := http.HandlerFunc(func(writer http.ResponseWriter, _ *http.Request) {
+		writer.WriteHeader(http.StatusOK)
+	})
+	for name, c := range map[string]struct {
+		mode       string
+		remoteAddr string
+		proto      string
+		tls        bool
+		path       string
+		statusCode int
+	}{
+		"disabled":                 {mode: HTTPSModeDisabled, remoteAddr: "192.0.2.1:1234", statusCode: http.StatusOK},
+		"redirect":                 {mode: HTTPSModeRedirect, remoteAddr: "192.0.2.1:1234", statusCode: http.StatusPermanentRedirect},
+		"reject":                   {mode: HTTPSModeReject, remoteAddr: "192.0.2.1:1234", statusCode: http.StatusBadRequest},
+		"tls":                      {mode: HTTPSModeReject, remoteAddr: "192.0.2.1:1234", tls: true, statusCode: http.StatusOK},
+		"trusted_proxy":            {mode: HTTPSModeReject, remoteAddr: "10.0.0.1:1234", proto: "https", statusCode: http.StatusOK},
+		"trusted_proxy_cidr":       {mode: HTTPSModeRedirect, remoteAddr: "172.16.1.1:1234", proto: "HTTPS", statusCode: http.StatusOK},
+		"trusted_proxy_http":       {mode: HTTPSModeReject, remoteAddr: "10.0.0.1:1234", proto: "http", statusCode: http.StatusBadRequest},
+		"untrusted_proxy":          {mode: HTTPSModeReject, remoteAddr: "192.0.2.1:1234", proto: "https", statusCode: http.StatusBadRequest},
+		"untrusted_proxy_redirect": {mode: HTTPSModeRedirect, remoteAddr: "192.0.2.1:1234", proto: "https", statusCode: http.StatusPermanentRedirect},
+		"exempt":                   {mode: HTTPSModeReject, remoteAddr: "192.0.2.1:1234", path: "/readyz", statusCode: http.StatusOK},
+		"exempt_redirect":          {mode: HTTPSModeRedirect, remoteAddr: "192.0.2.1:1234", path: "/readyz", statusCode: http.StatusOK},
+		"exempt_prefix":            {mode: HTTPSModeReject, remoteAddr: "192.0.2.1:1234", path: "/readyz/path", statusCode: http.StatusBadRequest},
+	} {
+		httpsOnly, err := HTTPSOnly(c.mode, trustedProxies, "/readyz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := "/path"
+		if c.path != "" {
+			path = c.path
+		}
+		request := httptest.NewRequest(http.MethodGet, "http://example.com"+path+"?query=1", nil)
+		request.RemoteAddr = c.remoteAddr
+		if c.proto != "" {
+			request.Header.Set("X-Forwarded-Proto", c.proto)
+		}
+		if c.tls {
+			request.TLS = &tls.ConnectionState{}
+		}
+		recorder := httptest.NewRecorder()
+		httpsOnly(ok).ServeHTTP(recorder, request)
+		if recorder.Code != c.statusCode {
+			t.Fatalf("%s: expected %d, got %d", name, c.statusCode, recorder.Code)
+		}
+		if location := recorder.Header().Get("Location"); c.statusCode == http.StatusPermanentRedirect &&
+			location != "https://example.com/path?query=1" {
+			t.Fatalf("%s: unexpected location %q", name, location)
+		}
+	}
+	if _, err := HTTPSOnly("unknown", nil); err == nil {
+		t.Fatal("expected an error for an unsupported mode")
+	}
+	if _, err := ParseTrustedProxies("10.0.0.1,not-an-ip"); err == nil {
+		t.Fatal("expected an error for an invalid trusted proxy")
+	}
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/antonio-alexander/go-blog-context/internal/response"
+)
+
+// InFlight tracks the number of requests currently being handled
+type InFlight struct {
+	count atomic.Int64
+}
+
+// Count returns the number of in-flight requests
+func (i *InFlight) Count() int64 {
+	return i.count.Load()
+}
+
+// Middleware counts the request as in-flight until the handler returns,
+// the decrement is deferred so it occurs even if the handler panics
+func (i *InFlight) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		i.count.Add(1)
+		defer i.count.Add(-1)
+
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// Handler returns the number of in-flight requests as json
+func (i *InFlight) Handler(writer http.ResponseWriter, request *http.Request) {
+	if err := response.NewEncoder(writer, request).Encode(map[string]int64{
+		"inflight": i.Count(),
+	}); err != nil {
+		fmt.Printf("error: %s\n", err.Error())
+	}
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestInFlight(t *testing.T) {
+	const concurrent int = 5
+
+	inflight := &InFlight{}
+	started, release := make(chan struct{}), make(chan struct{})
+	handler := inflight.Middleware(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+	var wg sync.WaitGroup
+	for i := 0; i < concurrent; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		}()
+	}
+	for i := 0; i < concurrent; i++ {
+		<-started
+	}
+	recorder := httptest.NewRecorder()
+	inflight.Handler(recorder, httptest.NewRequest(http.MethodGet, "/inflight", nil))
+	var count map[string]int64
+	if err := json.NewDecoder(recorder.Body).Decode(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count["inflight"] != int64(concurrent) {
+		t.Fatalf("expected %d in-flight requests, got %v", concurrent, count)
+	}
+	close(release)
+	wg.Wait()
+	if count := inflight.Count(); count != 0 {
+		t.Fatalf("expected no in-flight requests, got %d", count)
+	}
+
+	//the count is decremented even if the handler panics
+	handler = inflight.Middleware(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		panic("panic")
+	}))
+	func() {
+		defer func() { _ = recover() }()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}()
+	if count := inflight.Count(); count != 0 {
+		t.Fatalf("expected no in-flight requests after a panic, got %d", count)
+	}
+}
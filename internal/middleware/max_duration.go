@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/antonio-alexander/go-blog-context/internal/response"
+)
+
+// MaxDuration bounds the duration of a request, once the duration elapses
+// the context of the request is cancelled and a 503 is returned even if the
+// handler ignores cancellation (the handler will continue to execute, but
+// its response is discarded). Handlers that stream (i.e., need to flush)
+// aren't supported. A duration less than or equal to zero disables it
+func MaxDuration(duration time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		if duration <= 0 {
+			return next
+		}
+		//the message is json since the timeout handler doesn't set
+		// the content type (the default content type is used)
+		return http.TimeoutHandler(next, duration,
+			`{"code":"`+response.CodeTimeout+`","error":"request exceeded the maximum duration"}`)
+	}
+}
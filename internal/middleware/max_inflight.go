@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/antonio-alexander/go-blog-context/internal/response"
+)
+
+// MaxInFlight bounds the number of requests being handled concurrently,
+// once the limit is reached, requests are rejected with a 503 (rather
+// than queued). A limit less than or equal to zero disables it
+func MaxInFlight(limit int) Middleware {
+	return func(next http.Handler) http.Handler {
+		if limit <= 0 {
+			return next
+		}
+		semaphore := make(chan struct{}, limit)
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			select {
+			default:
+				response.WriteError(writer, http.StatusServiceUnavailable, response.CodeServerBusy,
+					errors.New("too many requests in flight"))
+				return
+			case semaphore <- struct{}{}:
+			}
+			defer func() { <-semaphore }()
+
+			next.ServeHTTP(writer, request)
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/antonio-alexander/go-blog-context/internal/response"
+)
+
+const (
+	DefaultContentType string = response.ContentTypeJSON
+	ContentTypeText    string = "text/plain; charset=utf-8"
+)
+
+// Middleware wraps a handler, it can execute logic before
+// and/or after the wrapped handler
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps the handler with the provided middleware, the first
+// middleware is the outermost (i.e., the first to execute)
+func Chain(handler http.Handler, middlewares ...Middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+type contentTypeWriter struct {
+	http.ResponseWriter
+	contentType string
+}
+
+func (c *contentTypeWriter) setDefault() {
+	if c.ResponseWriter.Header().Get("Content-Type") == "" {
+		c.ResponseWriter.Header().Set("Content-Type", c.contentType)
+	}
+}
+
+func (c *contentTypeWriter) WriteHeader(statusCode int) {
+	//responses without a body don't have a content type
+	if statusCode != http.StatusNoContent && statusCode != http.StatusNotModified {
+		c.setDefault()
+	}
+	c.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (c *contentTypeWriter) Write(b []byte) (int, error) {
+	c.setDefault()
+	return c.ResponseWriter.Write(b)
+}
+
+func (c *contentTypeWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+func (c *contentTypeWriter) Flush() {
+	if flusher, ok := c.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// ContentType will set the content type of the response to the
+// provided content type if the handler doesn't set one
+func ContentType(contentType string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			next.ServeHTTP(&contentTypeWriter{
+				ResponseWriter: writer,
+				contentType:    contentType,
+			}, request)
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestContentType(t *testing.T) {
+	for name, c := range map[string]struct {
+		handler     http.HandlerFunc
+		contentType string
+	}{
+		"default": {
+			handler: func(writer http.ResponseWriter, _ *http.Request) {
+				_, _ = writer.Write([]byte("{}"))
+			},
+			contentType: DefaultContentType,
+		},
+		"default_write_header": {
+			handler: func(writer http.ResponseWriter, _ *http.Request) {
+				writer.WriteHeader(http.StatusCreated)
+			},
+			contentType: DefaultContentType,
+		},
+		"explicit": {
+			handler: func(writer http.ResponseWriter, _ *http.Request) {
+				writer.Header().Set("Content-Type", ContentTypeText)
+				_, _ = writer.Write([]byte("text"))
+			},
+			contentType: ContentTypeText,
+		},
+		"no_content": {
+			handler: func(writer http.ResponseWriter, _ *http.Request) {
+				writer.WriteHeader(http.StatusNoContent)
+			},
+		},
+	} {
+		recorder := httptest.NewRecorder()
+		ContentType(DefaultContentType)(c.handler).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+		if contentType := recorder.Header().Get("Content-Type"); contentType != c.contentType {
+			t.Fatalf("%s: expected %q, got %q", name, c.contentType, contentType)
+		}
+	}
+}
+
+func TestChain(t *testing.T) {
+	var order []string
+	record := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(writer, request)
+			})
+		}
+	}
+	handler := Chain(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		order = append(order, "handler")
+	}), record("first"), record("second"))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if len(order) != 3 || order[0] != "first" || order[1] != "second" || order[2] != "handler" {
+		t.Fatalf("unexpected order: %v", order)
+	}
+}
@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/antonio-alexander/go-blog-context/internal/ctxkeys"
+)
+
+// Proto will store the protocol of the request (e.g., HTTP/1.1 or
+// HTTP/2.0) in the context of the request, cancellation behaves
+// differently depending on the protocol (i.e., closing a connection
+// vs resetting a stream)
+func Proto(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		ctx := ctxkeys.WithProto(request.Context(), request.Proto)
+		next.ServeHTTP(writer, request.WithContext(ctx))
+	})
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/antonio-alexander/go-blog-context/internal/ctxkeys"
+)
+
+func TestProto(t *testing.T) {
+	handler := Proto(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = io.WriteString(writer, ctxkeys.Proto(request.Context()))
+	}))
+	for expected, http2 := range map[string]bool{
+		"HTTP/1.1": false,
+		"HTTP/2.0": true,
+	} {
+		testServer := httptest.NewUnstartedServer(handler)
+		testServer.EnableHTTP2 = http2
+		testServer.StartTLS()
+		defer testServer.Close()
+		response, err := testServer.Client().Get(testServer.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		proto, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+		if string(proto) != expected || response.Proto != expected {
+			t.Fatalf("expected %s, got %s (%s)", expected, proto, response.Proto)
+		}
+	}
+	if proto := ctxkeys.Proto(httptest.NewRequest(http.MethodGet, "/", nil).Context()); proto != "" {
+		t.Fatalf("expected no protocol without the middleware, got %q", proto)
+	}
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/antonio-alexander/go-blog-context/internal/response"
+)
+
+// DefaultDrainingBody is the body returned by the readiness handler
+// when the server isn't ready
+const DefaultDrainingBody string = `{"status":"draining"}`
+
+// Readiness tracks whether the server should receive traffic, it's
+// ready until it's told otherwise (e.g., when shutting down)
+type Readiness struct {
+	notReady     atomic.Bool
+	drainingBody string
+}
+
+// NewReadiness creates a readiness with the (json) body returned when
+// the server isn't ready, if empty the default body is used
+func NewReadiness(drainingBody string) *Readiness {
+	if drainingBody == "" {
+		drainingBody = DefaultDrainingBody
+	}
+	return &Readiness{drainingBody: drainingBody}
+}
+
+// NotReady marks the server as not ready
+func (r *Readiness) NotReady() {
+	r.notReady.Store(true)
+}
+
+// Ready returns true if the server is ready
+func (r *Readiness) Ready() bool {
+	return !r.notReady.Load()
+}
+
+// Handler returns a 200 if the server is ready and a 503 (with the
+// draining body) otherwise
+func (r *Readiness) Handler(writer http.ResponseWriter, request *http.Request) {
+	if !r.Ready() {
+		writer.Header().Set("Content-Type", response.ContentTypeJSON)
+		writer.WriteHeader(http.StatusServiceUnavailable)
+		if _, err := fmt.Fprintln(writer, r.drainingBody); err != nil {
+			fmt.Printf("error: %s\n", err.Error())
+		}
+		return
+	}
+	if err := response.NewEncoder(writer, request).Encode(map[string]bool{
+		"ready": true,
+	}); err != nil {
+		fmt.Printf("error: %s\n", err.Error())
+	}
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/antonio-alexander/go-blog-context/internal/response"
+)
+
+func TestReadiness(t *testing.T) {
+	for drainingBody, expected := range map[string]string{
+		"":                      DefaultDrainingBody,
+		`{"status":"shutdown"}`: `{"status":"shutdown"}`,
+	} {
+		readiness := NewReadiness(drainingBody)
+		recorder := httptest.NewRecorder()
+		readiness.Handler(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("expected %d, got %d", http.StatusOK, recorder.Code)
+		}
+
+		//once draining, the body is returned with a 503
+		readiness.NotReady()
+		recorder = httptest.NewRecorder()
+		readiness.Handler(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		if recorder.Code != http.StatusServiceUnavailable {
+			t.Fatalf("expected %d, got %d", http.StatusServiceUnavailable, recorder.Code)
+		}
+		if contentType := recorder.Header().Get("Content-Type"); contentType != response.ContentTypeJSON {
+			t.Fatalf("expected %q, got %q", response.ContentTypeJSON, contentType)
+		}
+		if body := strings.TrimSpace(recorder.Body.String()); body != expected {
+			t.Fatalf("expected %s, got %s", expected, body)
+		}
+	}
+}
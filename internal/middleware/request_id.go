@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/antonio-alexander/go-blog-context/internal/ctxkeys"
+)
+
+const HeaderRequestId string = "X-Request-ID"
+
+// RequestId will store a request id in the context of the request, the
+// id is read from the header (if present) or generated, it's also set on
+// the response (using the same header) so clients can correlate logs. If
+// the header is empty, X-Request-ID is used
+func RequestId(header string, generate func() string) Middleware {
+	if header == "" {
+		header = HeaderRequestId
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			requestId := request.Header.Get(header)
+			if requestId == "" {
+				requestId = generate()
+			}
+			writer.Header().Set(header, requestId)
+			ctx := ctxkeys.WithRequestId(request.Context(), requestId)
+			next.ServeHTTP(writer, request.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/antonio-alexander/go-blog-context/internal/ctxkeys"
+)
+
+func TestRequestId(t *testing.T) {
+	generate := func() string { return "generated" }
+	for _, c := range []struct {
+		name     string
+		header   string
+		incoming string
+		id       string
+	}{
+		{"default_generated", "", "", "generated"},
+		{"default_read", "", "incoming", "incoming"},
+		{"custom_generated", "X-Correlation-ID", "", "generated"},
+		{"custom_read", "X-Correlation-ID", "incoming", "incoming"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			header := c.header
+			if header == "" {
+				header = HeaderRequestId
+			}
+			var stored string
+			handler := RequestId(c.header, generate)(http.HandlerFunc(func(_ http.ResponseWriter, request *http.Request) {
+				stored = ctxkeys.RequestId(request.Context())
+			}))
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			if c.incoming != "" {
+				request.Header.Set(header, c.incoming)
+			}
+			//the default header is ignored when a custom header is used
+			if c.header != "" {
+				request.Header.Set(HeaderRequestId, "ignored")
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			if stored != c.id {
+				t.Fatalf("expected %q to be stored, got %q", c.id, stored)
+			}
+			if id := recorder.Header().Get(header); id != c.id {
+				t.Fatalf("expected %q to be echoed in %s, got %q", c.id, header, id)
+			}
+		})
+	}
+}
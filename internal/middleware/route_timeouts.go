@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/antonio-alexander/go-blog-context/internal/ctxkeys"
+	"github.com/antonio-alexander/go-blog-context/internal/query"
+)
+
+// ParseRouteTimeouts parses a comma separated mapping of route patterns
+// to default timeouts (e.g., /ctx=60s,/=30s)
+func ParseRouteTimeouts(s string) (map[string]time.Duration, error) {
+	routeTimeouts := make(map[string]time.Duration)
+	for _, mapping := range strings.Split(s, ",") {
+		if mapping = strings.TrimSpace(mapping); mapping == "" {
+			continue
+		}
+		route, value, ok := strings.Cut(mapping, "=")
+		if route, value = strings.TrimSpace(route), strings.TrimSpace(value); !ok || !strings.HasPrefix(route, "/") {
+			return nil, fmt.Errorf("invalid route timeout: %s", mapping)
+		}
+		timeout, err := query.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid route timeout: %s", mapping)
+		}
+		routeTimeouts[route] = timeout
+	}
+	return routeTimeouts, nil
+}
+
+// RouteTimeouts stores the default timeout of the route pattern matched
+// by the mux (if configured) in the context of the request
+func RouteTimeouts(mux *http.ServeMux, routeTimeouts map[string]time.Duration) http.Handler {
+	if len(routeTimeouts) == 0 {
+		return mux
+	}
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if _, pattern := mux.Handler(request); pattern != "" {
+			if timeout, ok := routeTimeouts[pattern]; ok {
+				request = request.WithContext(ctxkeys.WithDefaultTimeout(request.Context(), timeout))
+			}
+		}
+		mux.ServeHTTP(writer, request)
+	})
+}
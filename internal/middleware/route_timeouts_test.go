@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/antonio-alexander/go-blog-context/internal/ctxkeys"
+)
+
+func TestParseRouteTimeouts(t *testing.T) {
+	routeTimeouts, err := ParseRouteTimeouts(" /work=120s, /ctx=60,, /=1m30s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]time.Duration{
+		"/work": 120 * time.Second,
+		"/ctx":  60 * time.Second,
+		"/":     90 * time.Second,
+	}
+	if !reflect.DeepEqual(routeTimeouts, expected) {
+		t.Fatalf("expected %v, got %v", expected, routeTimeouts)
+	}
+	for _, s := range []string{"/ctx", "ctx=60s", "/ctx=abc", "/ctx=0", "/ctx=-1s"} {
+		if _, err := ParseRouteTimeouts(s); err == nil {
+			t.Fatalf("%q: expected an error", s)
+		}
+	}
+}
+
+func TestRouteTimeouts(t *testing.T) {
+	mux := http.NewServeMux()
+	timeouts := make(map[string]time.Duration)
+	for _, pattern := range []string{"/", "/ctx", "/other"} {
+		pattern := pattern
+		mux.HandleFunc(pattern, func(_ http.ResponseWriter, request *http.Request) {
+			if timeout, ok := ctxkeys.DefaultTimeout(request.Context()); ok {
+				timeouts[pattern] = timeout
+			}
+		})
+	}
+	handler := RouteTimeouts(mux, map[string]time.Duration{"/ctx": time.Minute, "/": time.Second})
+	for _, target := range []string{"/ctx", "/anything", "/other"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+	//each route gets its configured timeout (based on the matched
+	// pattern), routes without one don't get a timeout
+	if expected := map[string]time.Duration{"/ctx": time.Minute, "/": time.Second}; !reflect.DeepEqual(timeouts, expected) {
+		t.Fatalf("expected %v, got %v", expected, timeouts)
+	}
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/antonio-alexander/go-blog-context/internal/ctxkeys"
+)
+
+const HeaderDebug string = "X-Debug"
+
+// Sample marks the context of a request as sampled, a request is sampled
+// if it has the debug header (only when made by a trusted proxy) or at
+// random given the rate (0 samples nothing, 1 samples everything) so
+// verbose logging can be limited to sampled requests
+func Sample(rate float64, trustedProxies []*net.IPNet) (Middleware, error) {
+	if rate < 0 || rate > 1 {
+		return nil, fmt.Errorf("sample rate must be between 0 and 1: %v", rate)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			sampled := rate > 0 && rand.Float64() < rate
+			if debug, _ := strconv.ParseBool(request.Header.Get(HeaderDebug)); debug &&
+				isTrustedProxy(request.RemoteAddr, trustedProxies) {
+				sampled = true
+			}
+			if sampled {
+				request = request.WithContext(ctxkeys.WithSampled(request.Context()))
+			}
+			next.ServeHTTP(writer, request)
+		})
+	}, nil
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/antonio-alexander/go-blog-context/internal/ctxkeys"
+)
+
+func TestSample(t *testing.T) {
+	//requests made by httptest are from 192.0.2.1
+	trusted, err := ParseTrustedProxies("192.0.2.0/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		name    string
+		rate    float64
+		proxies string
+		debug   string
+		sampled bool
+	}{
+		{"none", 0, "", "", false},
+		{"all", 1, "", "", true},
+		{"debug_trusted", 0, "192.0.2.0/24", "true", true},
+		{"debug_untrusted", 0, "10.0.0.0/8", "true", false},
+		{"debug_false", 0, "192.0.2.0/24", "false", false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			proxies, err := ParseTrustedProxies(c.proxies)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sample, err := Sample(c.rate, proxies)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var sampled bool
+			handler := sample(http.HandlerFunc(func(_ http.ResponseWriter, request *http.Request) {
+				sampled = ctxkeys.IsSampled(request.Context())
+			}))
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			if c.debug != "" {
+				request.Header.Set(HeaderDebug, c.debug)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), request)
+			if sampled != c.sampled {
+				t.Fatalf("expected sampled to be %t", c.sampled)
+			}
+		})
+	}
+	for _, rate := range []float64{-0.1, 1.1} {
+		if _, err := Sample(rate, nil); err == nil {
+			t.Fatalf("%v: expected an error", rate)
+		}
+	}
+
+	//only sampled requests are logged at debug
+	sample, _ := Sample(0, trusted)
+	handler := sample(DebugBodies(false, 1024)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})))
+	for debug, logged := range map[string]bool{"true": true, "": false} {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set(HeaderDebug, debug)
+		output := captureStdout(t, func() {
+			handler.ServeHTTP(httptest.NewRecorder(), request)
+		})
+		if strings.Contains(output, "debug:") != logged {
+			t.Fatalf("%q: expected logged to be %t: %q", debug, logged, output)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/antonio-alexander/go-blog-context/internal/ctxkeys"
+)
+
+const HeaderServerTiming string = "Server-Timing"
+
+// serverTimingWriter sets the Server-Timing header (once) before the
+// headers are written, phases completed after that aren't included
+type serverTimingWriter struct {
+	http.ResponseWriter
+	once    sync.Once
+	timings *ctxkeys.ServerTimings
+}
+
+func (s *serverTimingWriter) setHeader() {
+	s.once.Do(func() {
+		var metrics []string
+		for _, phase := range s.timings.Phases() {
+			metrics = append(metrics, fmt.Sprintf("%s;dur=%.3f",
+				phase.Name, float64(phase.Duration.Microseconds())/1000))
+		}
+		if len(metrics) > 0 {
+			s.ResponseWriter.Header().Set(HeaderServerTiming, strings.Join(metrics, ", "))
+		}
+	})
+}
+
+func (s *serverTimingWriter) WriteHeader(statusCode int) {
+	s.setHeader()
+	s.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (s *serverTimingWriter) Write(b []byte) (int, error) {
+	s.setHeader()
+	return s.ResponseWriter.Write(b)
+}
+
+func (s *serverTimingWriter) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+func (s *serverTimingWriter) Flush() {
+	s.setHeader()
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// ServerTiming stores timings in the context of the request, the phases
+// recorded by the handler (in milliseconds) are written in the
+// Server-Timing header (e.g., auth;dur=1.204, logic;dur=0.051)
+func ServerTiming(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		timings := &ctxkeys.ServerTimings{}
+		ctx := ctxkeys.WithTimings(request.Context(), timings)
+		next.ServeHTTP(&serverTimingWriter{
+			ResponseWriter: writer,
+			timings:        timings,
+		}, request.WithContext(ctx))
+	})
+}
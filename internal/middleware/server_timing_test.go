@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/antonio-alexander/go-blog-context/internal/ctxkeys"
+)
+
+func TestServerTiming(t *testing.T) {
+	for name, c := range map[string]struct {
+		phases   []ctxkeys.Timing
+		expected string
+	}{
+		"none": {},
+		"single": {
+			phases:   []ctxkeys.Timing{{Name: "wait", Duration: 2 * time.Second}},
+			expected: "wait;dur=2000.000",
+		},
+		"ordered": {
+			phases: []ctxkeys.Timing{
+				{Name: "auth", Duration: 1204 * time.Microsecond},
+				{Name: "logic", Duration: 51 * time.Microsecond},
+				{Name: "meta", Duration: 3 * time.Millisecond},
+			},
+			expected: "auth;dur=1.204, logic;dur=0.051, meta;dur=3.000",
+		},
+	} {
+		handler := ServerTiming(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			timings := ctxkeys.Timings(request.Context())
+			for _, phase := range c.phases {
+				timings.Add(phase.Name, phase.Duration)
+			}
+			writer.WriteHeader(http.StatusOK)
+			//phases completed once the headers are written aren't included
+			timings.Add("late", time.Millisecond)
+		}))
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+		if header, ok := recorder.Header()[HeaderServerTiming]; c.expected == "" && ok {
+			t.Fatalf("%s: expected no header, got %q", name, header)
+		}
+		if header := recorder.Header().Get(HeaderServerTiming); header != c.expected {
+			t.Fatalf("%s: expected %q, got %q", name, c.expected, header)
+		}
+	}
+
+	//without the middleware, phases are ignored
+	ctxkeys.Timings(httptest.NewRequest(http.MethodGet, "/", nil).Context()).Add("auth", time.Millisecond)
+}
@@ -0,0 +1,86 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+const tagQuery string = "query"
+
+var typeDuration = reflect.TypeOf(time.Duration(0))
+
+// DecodeQuery will populate the fields of dst (a pointer to a struct)
+// using the query parameters of the request, the query parameter is
+// identified by the query tag (e.g., `query:"timeout"`); fields whose
+// query parameter isn't present are left untouched so defaults can be
+// set before decoding. All invalid values are returned as a single
+// (joined) error
+func DecodeQuery(request *http.Request, dst any) error {
+	value := reflect.ValueOf(dst)
+	if value.Kind() != reflect.Pointer || value.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("dst must be a pointer to a struct, not %T", dst)
+	}
+	values, elem := request.URL.Query(), value.Elem()
+	var errs []error
+	for i := 0; i < elem.NumField(); i++ {
+		key, ok := elem.Type().Field(i).Tag.Lookup(tagQuery)
+		if !ok || key == "" || key == "-" {
+			continue
+		}
+		if !values.Has(key) {
+			continue
+		}
+		if err := decodeValue(elem.Field(i), values.Get(key)); err != nil {
+			errs = append(errs, fmt.Errorf("invalid value for %s (%q): %w", key, values.Get(key), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ParseDuration parses a duration string (e.g., 1m30s), if it's not a
+// valid duration string it falls back to parsing (integer) seconds
+func ParseDuration(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err == nil {
+		return d, nil
+	}
+	seconds, errSeconds := strconv.Atoi(s)
+	if errSeconds != nil {
+		return 0, err
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+func decodeValue(field reflect.Value, s string) error {
+	if field.Type() == typeDuration {
+		d, err := ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+	switch field.Kind() {
+	default:
+		return fmt.Errorf("unsupported type: %s", field.Type())
+	case reflect.String:
+		field.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(i)
+	}
+	return nil
+}
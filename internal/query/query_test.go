@@ -0,0 +1,79 @@
+package query
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testQuery struct {
+	Count   int           `query:"count"`
+	Timeout time.Duration `query:"timeout"`
+	Pretty  bool          `query:"pretty"`
+	Name    string        `query:"name"`
+	Ignored string
+}
+
+func TestDecodeQuery(t *testing.T) {
+	var params testQuery
+
+	request := httptest.NewRequest(http.MethodGet, "/?count=3&timeout=5&pretty=true&name=name&Ignored=x", nil)
+	if err := DecodeQuery(request, &params); err != nil {
+		t.Fatal(err)
+	}
+	expected := testQuery{Count: 3, Timeout: 5 * time.Second, Pretty: true, Name: "name"}
+	if params != expected {
+		t.Fatalf("expected %+v, got %+v", expected, params)
+	}
+
+	//fields whose query parameter isn't present keep their default
+	params = testQuery{Count: 1, Name: "default"}
+	if err := DecodeQuery(httptest.NewRequest(http.MethodGet, "/?pretty=1", nil), &params); err != nil {
+		t.Fatal(err)
+	}
+	if expected := (testQuery{Count: 1, Pretty: true, Name: "default"}); params != expected {
+		t.Fatalf("expected %+v, got %+v", expected, params)
+	}
+}
+
+func TestDecodeQueryErrors(t *testing.T) {
+	var params testQuery
+
+	//every invalid value is reported
+	err := DecodeQuery(httptest.NewRequest(http.MethodGet, "/?count=abc&timeout=abc&pretty=abc", nil), &params)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, key := range []string{"count", "timeout", "pretty"} {
+		if !strings.Contains(err.Error(), "invalid value for "+key) {
+			t.Fatalf("expected %s to be reported: %s", key, err)
+		}
+	}
+	if err := DecodeQuery(httptest.NewRequest(http.MethodGet, "/", nil), params); err == nil {
+		t.Fatal("expected an error for a non-pointer")
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	for s, expected := range map[string]time.Duration{
+		"30":    30 * time.Second,
+		"0":     0,
+		"1m30s": 90 * time.Second,
+		"250ms": 250 * time.Millisecond,
+	} {
+		d, err := ParseDuration(s)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", s, err)
+		}
+		if d != expected {
+			t.Fatalf("%s: expected %v, got %v", s, expected, d)
+		}
+	}
+	for _, s := range []string{"", "abc", "1.5", "30x"} {
+		if _, err := ParseDuration(s); err == nil {
+			t.Fatalf("%q: expected an error", s)
+		}
+	}
+}
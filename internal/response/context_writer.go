@@ -0,0 +1,39 @@
+package response
+
+import (
+	"context"
+	"io"
+)
+
+// contextWriterChunkSize is the maximum number of bytes written before
+// the context is checked again
+const contextWriterChunkSize int = 32 * 1024
+
+// contextWriter writes to the writer until the context is done, once
+// it's done writes fail with the error of the context; large writes are
+// chunked so a client disconnecting stops the write part way through
+// (the payload has already been built by then, see NewEncoder)
+type contextWriter struct {
+	ctx    context.Context
+	writer io.Writer
+}
+
+func (c *contextWriter) Write(p []byte) (int, error) {
+	var written int
+
+	for written < len(p) {
+		if err := c.ctx.Err(); err != nil {
+			return written, err
+		}
+		chunk := p[written:]
+		if len(chunk) > contextWriterChunkSize {
+			chunk = chunk[:contextWriterChunkSize]
+		}
+		n, err := c.writer.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,70 @@
+package response
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// ContentTypeJSON is the content type of error responses
+const ContentTypeJSON string = "application/json; charset=utf-8"
+
+// these codes are included in error responses, clients can switch on
+// them (unlike the error message, they're stable)
+const (
+	CodeBadRequest       string = "bad_request"
+	CodeMethodNotAllowed string = "method_not_allowed"
+	CodeInternalError    string = "internal_error"
+	CodeTimeout          string = "timeout"
+	CodeServerBusy       string = "server_busy"
+	CodeShuttingDown     string = "shutting_down"
+	CodeMissingToken     string = "missing_token"
+	CodeInvalidToken     string = "invalid_token"
+	CodeTokenExpired     string = "token_expired"
+	CodeTokenNotValidYet string = "token_not_valid_yet"
+	CodeInvalidSignature string = "invalid_signature"
+	CodeMalformedToken   string = "malformed_token"
+	CodeTokenRevoked     string = "token_revoked"
+	CodeWrongTokenType   string = "wrong_token_type"
+	CodeInvalidClaims    string = "invalid_claims"
+	CodeBindingMismatch  string = "token_binding_mismatch"
+	CodeForbidden        string = "forbidden"
+)
+
+// Error is the envelope of error responses
+type Error struct {
+	Code  string `json:"code"`
+	Error string `json:"error"`
+}
+
+// NewEncoder returns a json encoder for the response, if the request has
+// the pretty query parameter set to true (e.g., ?pretty=true) the output
+// is indented. Encoding fails once the context of the request is done
+// (e.g., the client disconnected) rather than writing to the client.
+// Encode marshals the whole value in memory before anything is written,
+// so a disconnect only stops the copy to the client (not the encoding);
+// large payloads should be split (e.g., paginated) to bound that work
+func NewEncoder(writer io.Writer, request *http.Request) *json.Encoder {
+	encoder := json.NewEncoder(&contextWriter{
+		ctx:    request.Context(),
+		writer: writer,
+	})
+	if pretty, _ := strconv.ParseBool(request.URL.Query().Get("pretty")); pretty {
+		encoder.SetIndent("", "  ")
+	}
+	return encoder
+}
+
+// WriteError writes an error response with the given status code
+func WriteError(writer http.ResponseWriter, statusCode int, code string, err error) {
+	writer.Header().Set("Content-Type", ContentTypeJSON)
+	writer.WriteHeader(statusCode)
+	if err := json.NewEncoder(writer).Encode(&Error{
+		Code:  code,
+		Error: err.Error(),
+	}); err != nil {
+		fmt.Printf("error: %s\n", err.Error())
+	}
+}
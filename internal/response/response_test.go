@@ -0,0 +1,68 @@
+package response
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewEncoderPretty(t *testing.T) {
+	for target, expected := range map[string]string{
+		"/":              "{\"a\":1}\n",
+		"/?pretty=false": "{\"a\":1}\n",
+		"/?pretty=abc":   "{\"a\":1}\n",
+		"/?pretty=true":  "{\n  \"a\": 1\n}\n",
+		"/?pretty=1":     "{\n  \"a\": 1\n}\n",
+	} {
+		var output bytes.Buffer
+		if err := NewEncoder(&output, httptest.NewRequest(http.MethodGet, target, nil)).Encode(map[string]int{"a": 1}); err != nil {
+			t.Fatalf("%s: %s", target, err)
+		}
+		if output.String() != expected {
+			t.Fatalf("%s: expected %q, got %q", target, expected, output.String())
+		}
+	}
+}
+
+func TestNewEncoderCancelled(t *testing.T) {
+	//nothing is written once the context of the request is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var output bytes.Buffer
+	request := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	if err := NewEncoder(&output, request).Encode(map[string]int{"a": 1}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if output.Len() != 0 {
+		t.Fatalf("expected nothing to be written, got %q", output.String())
+	}
+}
+
+// cancellingWriter cancels the context after the first write
+type cancellingWriter struct {
+	bytes.Buffer
+	cancel context.CancelFunc
+}
+
+func (c *cancellingWriter) Write(p []byte) (int, error) {
+	defer c.cancel()
+	return c.Buffer.Write(p)
+}
+
+func TestContextWriterAborts(t *testing.T) {
+	//the client disconnects part way through a large write, the rest
+	// of the write is abandoned
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	writer := &cancellingWriter{cancel: cancel}
+	n, err := (&contextWriter{ctx: ctx, writer: writer}).Write(make([]byte, 4*contextWriterChunkSize))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+	if n != contextWriterChunkSize || writer.Len() != contextWriterChunkSize {
+		t.Fatalf("expected a single chunk to be written, wrote %d", writer.Len())
+	}
+}
@@ -0,0 +1,164 @@
+package rest_audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/antonio-alexander/go-blog-context/internal/config"
+	"github.com/antonio-alexander/go-blog-context/internal/ctxkeys"
+)
+
+const (
+	auditStreamStdout string = "stdout"
+	auditStreamStderr string = "stderr"
+)
+
+// AuditEvent is the record written by the meta layer, the json tags
+// are the default (snake_case) field names
+type AuditEvent struct {
+	Id     string `json:"id"`
+	UserId string `json:"user_id"`
+	Kid    string `json:"kid"`
+	Reason string `json:"reason,omitempty"`
+	Method string `json:"method,omitempty"`
+	Path   string `json:"path,omitempty"`
+	Query  string `json:"query,omitempty"`
+	Proto  string `json:"proto,omitempty"`
+}
+
+// sensitiveParams are query parameters whose values are redacted
+// from audit events
+var sensitiveParams = map[string]bool{
+	"authorization": true,
+	"token":         true,
+	"access_token":  true,
+	"refresh_token": true,
+	"password":      true,
+	"secret":        true,
+}
+
+// sanitizeQuery redacts the values of sensitive query parameters, the
+// order of the parameters is preserved
+func sanitizeQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	params := strings.Split(rawQuery, "&")
+	for i, param := range params {
+		key, _, _ := strings.Cut(param, "=")
+		if unescaped, err := url.QueryUnescape(key); err == nil {
+			key = unescaped
+		}
+		if sensitiveParams[strings.ToLower(key)] {
+			params[i] = key + "=" + config.Redacted
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// requestInfo describes the request for audit events, the query is
+// only included (sanitized) if enabled
+func requestInfo(request *http.Request, includeQuery bool) ctxkeys.RequestInfo {
+	info := ctxkeys.RequestInfo{
+		Method: request.Method,
+		Path:   request.URL.Path,
+	}
+	if includeQuery {
+		info.Query = sanitizeQuery(request.URL.RawQuery)
+	}
+	return info
+}
+
+// parseAuditFields parses a comma separated mapping of default field
+// names to configured field names (e.g., user_id:userId,id:audit_id)
+func parseAuditFields(s string) (map[string]string, error) {
+	fieldNames := make(map[string]string)
+	for _, mapping := range strings.Split(s, ",") {
+		if mapping = strings.TrimSpace(mapping); mapping == "" {
+			continue
+		}
+		from, to, ok := strings.Cut(mapping, ":")
+		if from, to = strings.TrimSpace(from), strings.TrimSpace(to); !ok || from == "" || to == "" {
+			return nil, fmt.Errorf("invalid audit field mapping: %s", mapping)
+		}
+		fieldNames[from] = to
+	}
+	return fieldNames, nil
+}
+
+// auditWriter returns the stream audit events are written to, this allows
+// audit events to be routed separately from application logs
+func auditWriter(stream string) (io.Writer, error) {
+	switch stream {
+	default:
+		return nil, fmt.Errorf("unsupported audit stream: %s", stream)
+	case auditStreamStdout:
+		return os.Stdout, nil
+	case auditStreamStderr:
+		return os.Stderr, nil
+	}
+}
+
+type auditor struct {
+	sync.Mutex
+	writer     io.Writer
+	fieldNames map[string]string
+}
+
+func newAuditor(writer io.Writer, fieldNames map[string]string) *auditor {
+	return &auditor{
+		writer:     writer,
+		fieldNames: fieldNames,
+	}
+}
+
+// marshal will serialize the audit event, renaming any fields that
+// have been mapped to a different name
+func (a *auditor) marshal(event AuditEvent) ([]byte, error) {
+	bytes, err := json.Marshal(event)
+	if err != nil || len(a.fieldNames) == 0 {
+		return bytes, err
+	}
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(bytes, &fields); err != nil {
+		return nil, err
+	}
+	renamed := make(map[string]json.RawMessage, len(fields))
+	for name, value := range fields {
+		if to, ok := a.fieldNames[name]; ok {
+			name = to
+		}
+		renamed[name] = value
+	}
+	return json.Marshal(renamed)
+}
+
+// audit writes the audit event as a single json line, the request
+// and its protocol (stored in the context) are included in the event
+func (a *auditor) audit(ctx context.Context, event AuditEvent) {
+	request := ctxkeys.Request(ctx)
+	event.Method, event.Path, event.Query = request.Method, request.Path, request.Query
+	event.Proto = ctxkeys.Proto(ctx)
+	a.write(event)
+}
+
+// write writes the audit event as a single json line
+func (a *auditor) write(event AuditEvent) {
+	bytes, err := a.marshal(event)
+	if err != nil {
+		fmt.Printf("error: %s\n", err.Error())
+		return
+	}
+	a.Lock()
+	defer a.Unlock()
+	if _, err := a.writer.Write(append(bytes, '\n')); err != nil {
+		fmt.Printf("error: %s\n", err.Error())
+	}
+}
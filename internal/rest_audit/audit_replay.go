@@ -0,0 +1,76 @@
+package rest_audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// unmarshal will deserialize an audit event, renaming any fields that
+// have been mapped to a different name back to their default name (the
+// inverse of marshal)
+func (a *auditor) unmarshal(bytes []byte) (AuditEvent, error) {
+	var event AuditEvent
+
+	if len(a.fieldNames) == 0 {
+		err := json.Unmarshal(bytes, &event)
+		return event, err
+	}
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(bytes, &fields); err != nil {
+		return event, err
+	}
+	renamed := make(map[string]json.RawMessage, len(fields))
+	for name, value := range fields {
+		for from, to := range a.fieldNames {
+			if name == to {
+				name = from
+				break
+			}
+		}
+		renamed[name] = value
+	}
+	bytes, err := json.Marshal(renamed)
+	if err != nil {
+		return event, err
+	}
+	err = json.Unmarshal(bytes, &event)
+	return event, err
+}
+
+// replayAudit reads audit events (one json object per line) and writes
+// them using the auditor, malformed (or too long) lines are logged and
+// skipped
+func replayAudit(reader io.Reader, a *auditor) (replayed, skipped int, err error) {
+	err = readLines(reader, func(line int, text string, err error) {
+		var event AuditEvent
+
+		if err == nil {
+			event, err = a.unmarshal([]byte(text))
+		}
+		if err != nil {
+			fmt.Printf("error (line %d): %s\n", line, err.Error())
+			skipped++
+			return
+		}
+		a.write(event)
+		replayed++
+	})
+	return replayed, skipped, err
+}
+
+// replayAuditFile replays the audit events of the file
+func replayAuditFile(path string, a *auditor) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	replayed, skipped, err := replayAudit(file, a)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("replayed %d audit events from %s (%d skipped)\n", replayed, path, skipped)
+	return nil
+}
@@ -0,0 +1,34 @@
+package rest_audit
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReplayAudit(t *testing.T) {
+	//events are written with renamed fields and replayed with the same
+	// field names, malformed and oversized lines are skipped without
+	// ending the replay
+	fieldNames := map[string]string{"user_id": "uid"}
+	var input bytes.Buffer
+	newAuditor(&input, fieldNames).write(AuditEvent{Id: "1", UserId: "user", Kid: "kid"})
+	input.WriteString("not json\n")
+	input.WriteString("{\"id\":\"" + strings.Repeat("x", maxLineSize) + "\"}\n")
+	input.WriteString("\n")
+	newAuditor(&input, fieldNames).write(AuditEvent{Id: "2", UserId: "user", Kid: "kid"})
+	expected := input.String()
+
+	var output bytes.Buffer
+	replayed, skipped, err := replayAudit(strings.NewReader(expected), newAuditor(&output, fieldNames))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if replayed != 2 || skipped != 2 {
+		t.Fatalf("expected 2 replayed and 2 skipped, got %d and %d", replayed, skipped)
+	}
+	lines := strings.Split(expected, "\n")
+	if want := lines[0] + "\n" + lines[4] + "\n"; output.String() != want {
+		t.Fatalf("expected %q, got %q", want, output.String())
+	}
+}
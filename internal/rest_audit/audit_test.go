@@ -0,0 +1,161 @@
+package rest_audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/antonio-alexander/go-blog-context/internal/config"
+)
+
+func TestAuditSurvivesMiddleware(t *testing.T) {
+	//the claims (and kid) stored in the context by the audit endpoint
+	// must be read by metaAuditing with every middleware applied
+	signedToken := newTestTokenWithHeader(t, Claims{UserId: "user", Id: "id"}, map[string]any{"kid": "kid"})
+	output := captureStdout(t, func() {
+		testServer := newTestServer(t, "-debug_bodies", "-trace_sample", "1", "-audit_include_query")
+		if response := getToken(t, testServer, signedToken); response.StatusCode != http.StatusOK {
+			t.Errorf("expected %d, got %d", http.StatusOK, response.StatusCode)
+		}
+	})
+	events := auditEvents(output)
+	if len(events) != 1 {
+		t.Fatalf("expected 1 audit event, got %d: %s", len(events), output)
+	}
+	if event := events[0]; event.Id != "id" || event.UserId != "user" || event.Kid != "kid" || event.Path != "/token" {
+		t.Fatalf("unexpected audit event: %+v", event)
+	}
+}
+
+func TestAuditKid(t *testing.T) {
+	//tokens without a kid are audited with an empty kid
+	for kid, header := range map[string]map[string]any{
+		"kid": {"kid": "kid"},
+		"":    nil,
+	} {
+		var output bytes.Buffer
+		cfg := newTestTokenConfig(t)
+		cfg.auditor = newAuditor(&output, nil)
+		if recorder := serveToken(cfg, newTestTokenWithHeader(t, Claims{UserId: "user", Id: "id"}, header)); recorder.Code != http.StatusOK {
+			t.Fatalf("expected %d, got %d", http.StatusOK, recorder.Code)
+		}
+		events := auditEvents(output.String())
+		if len(events) != 1 || events[0].Kid != kid {
+			t.Fatalf("expected 1 audit event with kid %q, got %+v", kid, events)
+		}
+	}
+}
+
+func TestAuditFieldNames(t *testing.T) {
+	fieldNames, err := parseAuditFields("user_id:userId, id:audit_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var output bytes.Buffer
+	newAuditor(&output, fieldNames).write(AuditEvent{Id: "id", UserId: "user", Kid: "kid"})
+	var fields map[string]string
+	if err := json.Unmarshal(output.Bytes(), &fields); err != nil {
+		t.Fatal(err)
+	}
+	//remapped fields use the configured name, the others keep the
+	// default (snake_case) name
+	if fields["userId"] != "user" || fields["audit_id"] != "id" || fields["kid"] != "kid" {
+		t.Fatalf("unexpected audit event: %v", fields)
+	}
+	if _, ok := fields["user_id"]; ok {
+		t.Fatalf("expected user_id to be renamed: %v", fields)
+	}
+
+	for _, mapping := range []string{"user_id", "user_id:", ":userId"} {
+		if _, err := parseAuditFields(mapping); err == nil {
+			t.Fatalf("expected an error for %q", mapping)
+		}
+	}
+}
+
+func TestAuditStream(t *testing.T) {
+	signedToken := newTestToken(t, Claims{UserId: "user", Id: "id"})
+	for _, c := range []struct {
+		args   []string
+		stderr bool
+	}{
+		{nil, false},
+		{[]string{"-audit_stream", auditStreamStdout}, false},
+		{[]string{"-audit_stream", auditStreamStderr}, true},
+	} {
+		var stdout string
+		stderr := captureOutput(t, &os.Stderr, func() {
+			stdout = captureStdout(t, func() {
+				testServer := newTestServer(t, c.args...)
+				if response := getToken(t, testServer, signedToken); response.StatusCode != http.StatusOK {
+					t.Errorf("expected %d, got %d", http.StatusOK, response.StatusCode)
+				}
+			})
+		})
+		routed, other := auditEvents(stdout), auditEvents(stderr)
+		if c.stderr {
+			routed, other = other, routed
+		}
+		if len(routed) != 1 || len(other) != 0 {
+			t.Fatalf("%v: expected the audit event on stderr=%t, got stdout %q, stderr %q", c.args, c.stderr, stdout, stderr)
+		}
+	}
+	if _, err := NewTestHandler(Config{Args: []string{"-audit_stream", "file"}}); err == nil {
+		t.Fatal("expected an error for an unsupported stream")
+	}
+}
+
+func TestSanitizeQuery(t *testing.T) {
+	for rawQuery, expected := range map[string]string{
+		"":                                  "",
+		"a=1&b=2":                           "a=1&b=2",
+		"token=abc&a=1":                     "token=" + config.Redacted + "&a=1",
+		"a=1&Access_Token=abc&password=xyz": "a=1&Access_Token=" + config.Redacted + "&password=" + config.Redacted,
+		"refresh%5Ftoken=abc":               "refresh_token=" + config.Redacted,
+		"secret":                            "secret=" + config.Redacted,
+	} {
+		if sanitized := sanitizeQuery(rawQuery); sanitized != expected {
+			t.Fatalf("%q: expected %q, got %q", rawQuery, expected, sanitized)
+		}
+	}
+}
+
+func TestAuditIncludeQuery(t *testing.T) {
+	signedToken := newTestToken(t, Claims{UserId: "user", Id: "id"})
+	for _, c := range []struct {
+		args  []string
+		query string
+	}{
+		{nil, ""},
+		{[]string{"-audit_include_query"}, "a=1&token=" + config.Redacted},
+	} {
+		output := captureStdout(t, func() {
+			testServer := newTestServer(t, c.args...)
+			request, err := http.NewRequest(http.MethodGet, testServer.URL+"/token?a=1&token=secret-query", nil)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			request.Header.Set("Authorization", "Bearer "+signedToken)
+			response, err := testServer.Client().Do(request)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			response.Body.Close()
+		})
+		if strings.Contains(output, "secret-query") {
+			t.Fatalf("%v: expected the token to be redacted: %s", c.args, output)
+		}
+		events := auditEvents(output)
+		if len(events) != 1 {
+			t.Fatalf("%v: expected 1 audit event, got %d: %s", c.args, len(events), output)
+		}
+		if event := events[0]; event.Method != http.MethodGet || event.Path != "/token" || event.Query != c.query {
+			t.Fatalf("%v: unexpected audit event: %+v", c.args, event)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package rest_audit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const claimUserId string = "user_id"
+
+// applyClaimsNamespace will read the user_id from a namespaced claim
+// (e.g., https://myapp/user_id) when it's not present at the top-level,
+// identity providers like Auth0 require custom claims to be namespaced
+func applyClaimsNamespace(token *jwt.Token, claims *Claims, namespace string) error {
+	if namespace == "" || claims.UserId != "" {
+		return nil
+	}
+	parts := strings.Split(token.Raw, ".")
+	if len(parts) != 3 {
+		return errors.New("token contains an invalid number of segments")
+	}
+	payload, err := jwt.DecodeSegment(parts[1])
+	if err != nil {
+		return err
+	}
+	namespacedClaims := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(payload, &namespacedClaims); err != nil {
+		return err
+	}
+	if !strings.HasSuffix(namespace, "/") {
+		namespace = namespace + "/"
+	}
+	userId, ok := namespacedClaims[namespace+claimUserId]
+	if !ok {
+		return nil
+	}
+	return json.Unmarshal(userId, &claims.UserId)
+}
+
+// validateClaimStrings confirms that the payload of the token is valid
+// utf-8 and that the string claims are at most max bytes long (0 is
+// unlimited). The json decoder replaces invalid utf-8 (and unpaired
+// surrogates) with the replacement character, so claims containing it
+// are rejected as well
+func validateClaimStrings(token *jwt.Token, claims *Claims, max int) error {
+	if parts := strings.Split(token.Raw, "."); len(parts) == 3 {
+		payload, err := jwt.DecodeSegment(parts[1])
+		if err != nil {
+			return err
+		}
+		if !utf8.Valid(payload) {
+			return errors.New("claims aren't valid utf-8")
+		}
+	}
+	for name, value := range map[string]string{
+		"id":        claims.Id,
+		claimUserId: claims.UserId,
+		"sub":       claims.Subject,
+		"iss":       claims.Issuer,
+		"token_use": claims.TokenUse,
+		"tenant":    claims.Tenant,
+	} {
+		if strings.ContainsRune(value, utf8.RuneError) {
+			return fmt.Errorf("%s claim isn't valid utf-8", name)
+		}
+		if max > 0 && len(value) > max {
+			return fmt.Errorf("%s claim exceeds %d bytes", name, max)
+		}
+	}
+	return nil
+}
+
+// Confirmation binds the token to the client presenting it
+type Confirmation struct {
+	IP string `json:"ip,omitempty"`
+}
+
+// validateTokenBinding confirms that the token is bound to the ip
+// address of the client, tokens that aren't bound are rejected
+func validateTokenBinding(claims *Claims, clientIP string) error {
+	if claims.Cnf == nil || claims.Cnf.IP == "" {
+		return errors.New("token isn't bound to a client")
+	}
+	bound, client := net.ParseIP(claims.Cnf.IP), net.ParseIP(clientIP)
+	if bound == nil || client == nil || !bound.Equal(client) {
+		return fmt.Errorf("token is bound to %s, not %s", claims.Cnf.IP, clientIP)
+	}
+	return nil
+}
+
+// tokenValidator validates a parsed token and its claims, a non-nil
+// error rejects the token
+type tokenValidator func(token *jwt.Token, claims *Claims) error
+
+func requireTokenType(token *jwt.Token, _ *Claims) error {
+	if typ, _ := token.Header["typ"].(string); !strings.EqualFold(typ, tokenType) {
+		return errors.New("missing typ header")
+	}
+	return nil
+}
+
+func requireExpiresAt(_ *jwt.Token, claims *Claims) error {
+	if claims.ExpiresAt == nil {
+		return errors.New("missing exp claim")
+	}
+	return nil
+}
+
+func requireIssuedAt(_ *jwt.Token, claims *Claims) error {
+	if claims.IssuedAt == nil {
+		return errors.New("missing iat claim")
+	}
+	return nil
+}
+
+func requireSubject(_ *jwt.Token, claims *Claims) error {
+	if claims.Subject == "" && claims.UserId == "" {
+		return errors.New("missing sub or user_id claim")
+	}
+	return nil
+}
+
+// strictValidators are the validators executed when strict parsing
+// is enabled
+var strictValidators = []tokenValidator{
+	requireTokenType,
+	requireExpiresAt,
+	requireIssuedAt,
+	requireSubject,
+}
+
+// validateToken executes the validators (in order) and returns
+// the first error
+func validateToken(token *jwt.Token, claims *Claims, validators ...tokenValidator) error {
+	for _, validator := range validators {
+		if err := validator(token, claims); err != nil {
+			return err
+		}
+	}
+	return nil
+}
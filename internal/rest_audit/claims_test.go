@@ -0,0 +1,220 @@
+package rest_audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/antonio-alexander/go-blog-context/internal/ctxkeys"
+	"github.com/antonio-alexander/go-blog-context/internal/response"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// newTestMapToken signs the (arbitrary) claims with the test key
+func newTestMapToken(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+
+	signedToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testJwtKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signedToken
+}
+
+func TestClaimsNamespace(t *testing.T) {
+	exp := time.Now().Add(time.Minute).Unix()
+	for _, c := range []struct {
+		name      string
+		namespace string
+		claims    jwt.MapClaims
+		body      string
+	}{
+		{"namespaced", "https://myapp", jwt.MapClaims{"id": "id", "exp": exp, "https://myapp/user_id": "namespaced"},
+			"audit (id); userId: namespaced\n"},
+		{"trailing_slash", "https://myapp/", jwt.MapClaims{"id": "id", "exp": exp, "https://myapp/user_id": "namespaced"},
+			"audit (id); userId: namespaced\n"},
+		{"top_level_wins", "https://myapp", jwt.MapClaims{"id": "id", "exp": exp, "user_id": "top", "https://myapp/user_id": "namespaced"},
+			"audit (id); userId: top\n"},
+		{"disabled", "", jwt.MapClaims{"id": "id", "exp": exp, "https://myapp/user_id": "namespaced"},
+			"audit (id); userId: \n"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			cfg := newTestTokenConfig(t)
+			cfg.namespace = c.namespace
+			recorder := serveToken(cfg, newTestMapToken(t, c.claims))
+			if recorder.Code != http.StatusOK || recorder.Body.String() != c.body {
+				t.Fatalf("expected %q, got %d %q", c.body, recorder.Code, recorder.Body)
+			}
+		})
+	}
+}
+
+func TestStrictValidators(t *testing.T) {
+	exp, iat := time.Now().Add(time.Minute).Unix(), time.Now().Unix()
+	for _, c := range []struct {
+		name   string
+		claims jwt.MapClaims
+		typ    bool
+		code   int
+	}{
+		{"valid", jwt.MapClaims{"exp": exp, "iat": iat, "sub": "sub"}, true, http.StatusOK},
+		{"valid_user_id", jwt.MapClaims{"exp": exp, "iat": iat, "user_id": "user"}, true, http.StatusOK},
+		{"missing_typ", jwt.MapClaims{"exp": exp, "iat": iat, "sub": "sub"}, false, http.StatusUnauthorized},
+		{"missing_exp", jwt.MapClaims{"iat": iat, "sub": "sub"}, true, http.StatusUnauthorized},
+		{"missing_iat", jwt.MapClaims{"exp": exp, "sub": "sub"}, true, http.StatusUnauthorized},
+		{"missing_sub", jwt.MapClaims{"exp": exp, "iat": iat}, true, http.StatusUnauthorized},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, c.claims)
+			if !c.typ {
+				delete(token.Header, "typ")
+			}
+			signedToken, err := token.SignedString([]byte(testJwtKey))
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg := newTestTokenConfig(t)
+			cfg.validators = strictValidators
+			if recorder := serveToken(cfg, signedToken); recorder.Code != c.code {
+				t.Fatalf("expected %d, got %d (%s)", c.code, recorder.Code, recorder.Body)
+			}
+			//lenient mode (the default) accepts the token (as long as
+			// it hasn't expired)
+			if recorder := serveToken(newTestTokenConfig(t), signedToken); recorder.Code != http.StatusOK {
+				t.Fatalf("expected %d when lenient, got %d (%s)", http.StatusOK, recorder.Code, recorder.Body)
+			}
+		})
+	}
+}
+
+func TestStrictWrongTokenType(t *testing.T) {
+	//the wrong typ is reported the same regardless of strict mode
+	claims := jwt.MapClaims{"exp": time.Now().Add(time.Minute).Unix(), "iat": time.Now().Unix(), "sub": "sub"}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["typ"] = "refresh+jwt"
+	signedToken, err := token.SignedString([]byte(testJwtKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, validators := range map[string][]tokenValidator{
+		"lenient": nil,
+		"strict":  strictValidators,
+	} {
+		cfg := newTestTokenConfig(t)
+		cfg.validators = validators
+		recorder := serveToken(cfg, signedToken)
+		if recorder.Code != http.StatusUnauthorized {
+			t.Fatalf("%s: expected %d, got %d", name, http.StatusUnauthorized, recorder.Code)
+		}
+		if e := decodeError(t, recorder); e.Code != response.CodeWrongTokenType {
+			t.Fatalf("%s: expected code %q, got %q", name, response.CodeWrongTokenType, e.Code)
+		}
+	}
+}
+
+func TestClaimsFromContext(t *testing.T) {
+	if _, ok := ClaimsFromContext(context.Background()); ok {
+		t.Fatal("expected no claims")
+	}
+	claims := Claims{Id: "id", UserId: "user", Tenant: "tenant"}
+	ctx := ctxkeys.WithClaims(context.Background(), claims)
+	//the claims are stored by value, so they can't be modified once stored
+	claims.UserId = "modified"
+	stored, ok := ClaimsFromContext(ctx)
+	if !ok {
+		t.Fatal("expected the claims to be stored")
+	}
+	if expected := (Claims{Id: "id", UserId: "user", Tenant: "tenant"}); !reflect.DeepEqual(stored, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, stored)
+	}
+	//the individual accessors delegate to the stored claims
+	if ctxkeys.Id(ctx) != "id" || ctxkeys.UserId(ctx) != "user" {
+		t.Fatalf("unexpected accessors: %q, %q", ctxkeys.Id(ctx), ctxkeys.UserId(ctx))
+	}
+}
+
+func TestTokenBinding(t *testing.T) {
+	//requests made by httptest are from 192.0.2.1
+	for _, c := range []struct {
+		name    string
+		cnf     *Confirmation
+		enforce bool
+		code    int
+	}{
+		{"match", &Confirmation{IP: "192.0.2.1"}, true, http.StatusOK},
+		{"mismatch", &Confirmation{IP: "192.0.2.2"}, true, http.StatusUnauthorized},
+		{"unbound", nil, true, http.StatusUnauthorized},
+		{"not_enforced", &Confirmation{IP: "192.0.2.2"}, false, http.StatusOK},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			cfg := newTestTokenConfig(t)
+			cfg.bindToken = c.enforce
+			recorder := serveToken(cfg, newTestToken(t, Claims{UserId: "user", Id: "id", Cnf: c.cnf}))
+			if recorder.Code != c.code {
+				t.Fatalf("expected %d, got %d", c.code, recorder.Code)
+			}
+			if c.code == http.StatusUnauthorized {
+				var e response.Error
+				if err := json.NewDecoder(recorder.Body).Decode(&e); err != nil || e.Code != response.CodeBindingMismatch {
+					t.Fatalf("expected code %q, got %+v (%v)", response.CodeBindingMismatch, e, err)
+				}
+			}
+		})
+	}
+}
+
+// newTestRawToken signs the (raw) payload with the test key, the payload
+// doesn't have to be valid json (or utf-8)
+func newTestRawToken(t *testing.T, payload string) string {
+	t.Helper()
+
+	signingString := jwt.EncodeSegment([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + jwt.EncodeSegment([]byte(payload))
+	signature, err := jwt.SigningMethodHS256.Sign(signingString, []byte(testJwtKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signingString + "." + signature
+}
+
+func TestClaimStrings(t *testing.T) {
+	exp := strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10)
+	for _, c := range []struct {
+		name    string
+		payload string
+		code    int
+	}{
+		{"valid", `{"id":"id","user_id":"user","exp":` + exp + `}`, http.StatusOK},
+		{"invalid_utf8", `{"id":"id","user_id":"` + "\xff\xfe" + `","exp":` + exp + `}`, http.StatusUnauthorized},
+		{"unpaired_surrogate", `{"id":"id","user_id":"\ud800","exp":` + exp + `}`, http.StatusUnauthorized},
+		{"oversized", `{"id":"id","user_id":"` + strings.Repeat("x", 17) + `","exp":` + exp + `}`, http.StatusUnauthorized},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var output bytes.Buffer
+			cfg := newTestTokenConfig(t)
+			cfg.maxClaimLen = 16
+			cfg.auditor = newAuditor(&output, nil)
+			recorder := serveToken(cfg, newTestRawToken(t, c.payload))
+			if recorder.Code != c.code {
+				t.Fatalf("expected %d, got %d (%s)", c.code, recorder.Code, recorder.Body)
+			}
+			if c.code == http.StatusOK {
+				return
+			}
+			var e response.Error
+			if err := json.NewDecoder(recorder.Body).Decode(&e); err != nil || e.Code != response.CodeInvalidClaims {
+				t.Fatalf("expected code %q, got %+v (%v)", response.CodeInvalidClaims, e, err)
+			}
+			//rejected claims aren't written to the audit log
+			if output.Len() != 0 {
+				t.Fatalf("expected no audit events, got %s", output.String())
+			}
+		})
+	}
+}
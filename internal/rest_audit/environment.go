@@ -0,0 +1,45 @@
+package rest_audit
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	environmentDevelopment string = "development"
+	environmentProduction  string = "production"
+)
+
+// defaultJwtKey is the default (well known) hmac key, it's only
+// acceptable for development
+const defaultJwtKey string = "secret"
+
+// errDefaultJwtKey is returned when the default jwt key is used in
+// production
+var errDefaultJwtKey = errors.New("the default jwt key can't be used in production, set JWT_KEY")
+
+// validateEnvironment returns an error if the configuration is a
+// critical misconfiguration for the environment
+func validateEnvironment(environment, jwtAlg, jwtKey string) error {
+	switch environment {
+	default:
+		return fmt.Errorf("unsupported environment: %s", environment)
+	case environmentDevelopment:
+		return nil
+	case environmentProduction:
+		if jwtAlg == jwtAlgHMAC && jwtKey == defaultJwtKey {
+			return errDefaultJwtKey
+		}
+		return nil
+	}
+}
+
+// misconfigured returns the error of a critical misconfiguration, if
+// fail fast is enabled it panics instead (e.g., when the application
+// is embedded and the error may be ignored)
+func misconfigured(failFast bool, err error) error {
+	if err != nil && failFast {
+		panic(err)
+	}
+	return err
+}
@@ -0,0 +1,41 @@
+package rest_audit
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestProductionDefaultKey(t *testing.T) {
+	//production refuses to start with the default key (from the flag
+	// default or set explicitly)
+	for _, c := range []struct {
+		args []string
+		envs map[string]string
+		err  error
+	}{
+		{[]string{"-env", environmentProduction}, nil, errDefaultJwtKey},
+		{[]string{"-env", environmentProduction, "-jwt_key", defaultJwtKey}, nil, errDefaultJwtKey},
+		{nil, map[string]string{"ENV": environmentProduction}, errDefaultJwtKey},
+		{[]string{"-env", environmentProduction, "-jwt_key", "not-the-default"}, nil, nil},
+		{[]string{"-env", environmentDevelopment}, nil, nil},
+	} {
+		if _, err := NewTestHandler(Config{Args: c.args, Envs: c.envs}); !errors.Is(err, c.err) {
+			t.Fatalf("%v %v: expected %v, got %v", c.args, c.envs, c.err, err)
+		}
+	}
+	if _, err := NewTestHandler(Config{Args: []string{"-env", "staging"}}); err == nil {
+		t.Fatal("expected an error for an unsupported environment")
+	}
+}
+
+func TestProductionDefaultKeyFailFast(t *testing.T) {
+	//fail fast panics rather than returning the error
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("expected a panic")
+		} else if err, ok := r.(error); !ok || !errors.Is(err, errDefaultJwtKey) {
+			t.Fatalf("expected %v, got %v", errDefaultJwtKey, r)
+		}
+	}()
+	_, _ = NewTestHandler(Config{Args: []string{"-env", environmentProduction, "-fail_fast"}})
+}
@@ -0,0 +1,42 @@
+package rest_audit
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+)
+
+// maxLineSize is the maximum size (in bytes) of a line read from a file,
+// longer lines are reported as too long (and skipped) instead of ending
+// the read
+const maxLineSize int = 1024 * 1024
+
+var errLineTooLong = errors.New("line too long")
+
+// readLines calls fn with each (trimmed) line of the reader, a line longer
+// than maxLineSize is discarded and fn is called with errLineTooLong
+func readLines(reader io.Reader, fn func(line int, text string, err error)) error {
+	bufReader := bufio.NewReaderSize(reader, maxLineSize)
+	for line := 1; ; line++ {
+		bytes, err := bufReader.ReadSlice('\n')
+		text := strings.TrimSpace(string(bytes))
+		tooLong := false
+		for errors.Is(err, bufio.ErrBufferFull) {
+			tooLong = true
+			_, err = bufReader.ReadSlice('\n')
+		}
+		switch {
+		case tooLong:
+			fn(line, "", errLineTooLong)
+		case text != "":
+			fn(line, text, nil)
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -2,112 +2,690 @@ package rest_audit
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
-	"sync"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/antonio-alexander/go-blog-context/internal/config"
+	"github.com/antonio-alexander/go-blog-context/internal/ctxkeys"
+	"github.com/antonio-alexander/go-blog-context/internal/echo"
+	"github.com/antonio-alexander/go-blog-context/internal/middleware"
+	"github.com/antonio-alexander/go-blog-context/internal/response"
+	"github.com/antonio-alexander/go-blog-context/internal/server"
 
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
 )
 
-type ctxKey string
-
 const (
-	keyCtxUserId ctxKey = "user_id"
-	keyCtxId     ctxKey = "id"
+	tokenUseAccess string = "access"
+	tokenType      string = "JWT"
 )
 
 type Claims struct {
 	jwt.RegisteredClaims
-	Id     string `json:"id"`
-	UserId string `json:"user_id"`
+	Id       string        `json:"id"`
+	UserId   string        `json:"user_id"`
+	TokenUse string        `json:"token_use,omitempty"`
+	Tenant   string        `json:"tenant,omitempty"`
+	Cnf      *Confirmation `json:"cnf,omitempty"`
+}
+
+func (c Claims) GetId() string {
+	return c.Id
+}
+
+func (c Claims) GetUserId() string {
+	return c.UserId
+}
+
+// ClaimsFromContext returns the validated claims stored in the context
+func ClaimsFromContext(ctx context.Context) (Claims, bool) {
+	claims, ok := ctxkeys.Claims(ctx).(Claims)
+	return claims, ok
+}
+
+// classifyJWTError returns the status code and error code for an error
+// returned when parsing a token, the library's sentinel errors are used
+// (rather than the error message or flags) so the classification doesn't
+// depend on how the errors are wrapped; errors other than validation
+// errors are treated as internal errors
+func classifyJWTError(err error) (int, string) {
+	switch {
+	default:
+		return http.StatusInternalServerError, response.CodeInternalError
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return http.StatusUnauthorized, response.CodeTokenExpired
+	case errors.Is(err, jwt.ErrTokenNotValidYet),
+		errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		return http.StatusUnauthorized, response.CodeTokenNotValidYet
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid),
+		errors.Is(err, jwt.ErrTokenUnverifiable):
+		return http.StatusUnauthorized, response.CodeInvalidSignature
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		return http.StatusBadRequest, response.CodeMalformedToken
+	case errors.Is(err, jwt.ErrTokenInvalidClaims),
+		errors.Is(err, jwt.ErrTokenInvalidAudience),
+		errors.Is(err, jwt.ErrTokenInvalidIssuer):
+		return http.StatusUnauthorized, response.CodeInvalidToken
+	}
 }
 
-func endpointToken(jwtKey string) func(http.ResponseWriter, *http.Request) {
+// logTokenHeader logs the (non-secret) fields of the token header that
+// are useful when troubleshooting algorithm/kid mismatches, the token
+// itself (and its payload) is never logged
+func logTokenHeader(requestId string, token *jwt.Token) {
+	fmt.Printf("%s jwt header: alg=%v, typ=%v, kid=%v\n", requestId,
+		token.Header["alg"], token.Header["typ"], token.Header["kid"])
+}
+
+// validateTokenType will confirm that the token is an access token, tokens
+// without a token_use claim are treated as access tokens. This prevents
+// token confusion (e.g., presenting a refresh token as an access token)
+func validateTokenType(token *jwt.Token, claims *Claims) error {
+	if typ, ok := token.Header["typ"].(string); ok && !strings.EqualFold(typ, tokenType) {
+		return fmt.Errorf("unexpected token type: %s", typ)
+	}
+	if claims.TokenUse != "" && claims.TokenUse != tokenUseAccess {
+		return fmt.Errorf("unexpected token use: %s", claims.TokenUse)
+	}
+	return nil
+}
+
+type tokenConfig struct {
+	keyFunc          jwt.Keyfunc
+	parser           *tokenParser
+	claimsValidators []ClaimsValidator
+	claimsMapper     ClaimsMapper
+	extractor        *tokenExtractor
+	auditor          *auditor
+	revocations      RevocationStore
+	successStatus    int
+	namespace        string
+	validators       []tokenValidator
+	logHeader        bool
+	bindToken        bool
+	proxies          []*net.IPNet
+	includeQuery     bool
+	cache            *tokenCache
+	maxClaimLen      int
+	metrics          *validationMetrics
+}
+
+// validateSuccessStatus confirms that the status returned on success is
+// either a 200 (with a body) or a 204 (no content)
+func validateSuccessStatus(successStatus int) error {
+	switch successStatus {
+	default:
+		return fmt.Errorf("unsupported audit success status: %d", successStatus)
+	case http.StatusOK, http.StatusNoContent:
+		return nil
+	}
+}
+
+func endpointToken(cfg tokenConfig) func(http.ResponseWriter, *http.Request) {
 	return func(writer http.ResponseWriter, request *http.Request) {
-		token := request.Header.Get("authorization")
-		if s := request.URL.Query().Get("authorization"); s != "" {
-			token = s
-		}
-		fmt.Printf("token: %s\n", token)
-		claims := &Claims{}
-		if _, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
-			return []byte(jwtKey), nil
-		}); err != nil {
+		tAuth := time.Now()
+		writer.Header().Set("Content-Type", middleware.ContentTypeText)
+		request = request.WithContext(ctxkeys.WithRequest(request.Context(),
+			requestInfo(request, cfg.includeQuery)))
+		token, err := cfg.extractor.extractToken(request)
+		if errors.Is(err, errMissingToken) {
+			writer.Header().Set("WWW-Authenticate", schemeBearer)
+			response.WriteError(writer, http.StatusUnauthorized, response.CodeMissingToken, err)
+			return
+		}
+		if err != nil {
 			fmt.Printf("error: %s\n", err.Error())
-			writer.WriteHeader(http.StatusInternalServerError)
-			if _, err := writer.Write([]byte(err.Error())); err != nil {
-				fmt.Printf("error: %s\n", err.Error())
+			response.WriteError(writer, http.StatusBadRequest, response.CodeBadRequest, err)
+			return
+		}
+		parsedToken, claims, err := parseToken(token, cfg.parser, cfg.keyFunc, cfg.cache)
+		if cfg.logHeader && parsedToken != nil {
+			logTokenHeader(ctxkeys.RequestId(request.Context()), parsedToken)
+		}
+		if err != nil {
+			fmt.Printf("error: %s\n", err.Error())
+			statusCode, code := classifyJWTError(err)
+			cfg.metrics.increment(jwtOutcome(code))
+			response.WriteError(writer, statusCode, code, err)
+			return
+		}
+		if err := applyClaimsNamespace(parsedToken, claims, cfg.namespace); err != nil {
+			cfg.metrics.increment(outcomeInvalid)
+			response.WriteError(writer, http.StatusUnauthorized, response.CodeInvalidClaims, err)
+			return
+		}
+		//the claims are validated before they're audited so malformed
+		// (or oversized) claims aren't written to the audit log
+		if err := validateClaimStrings(parsedToken, claims, cfg.maxClaimLen); err != nil {
+			cfg.metrics.increment(outcomeInvalid)
+			response.WriteError(writer, http.StatusUnauthorized, response.CodeInvalidClaims, err)
+			return
+		}
+		//the token type is checked before the (strict) validators so a
+		// token with the wrong type is reported as such in either mode
+		if err := validateTokenType(parsedToken, claims); err != nil {
+			cfg.metrics.increment(outcomeInvalid)
+			cfg.auditor.audit(request.Context(), AuditEvent{
+				Id:     claims.Id,
+				UserId: claims.UserId,
+				Reason: response.CodeWrongTokenType,
+			})
+			response.WriteError(writer, http.StatusUnauthorized, response.CodeWrongTokenType, err)
+			return
+		}
+		if err := validateToken(parsedToken, claims, cfg.validators...); err != nil {
+			cfg.metrics.increment(outcomeInvalid)
+			cfg.auditor.audit(request.Context(), AuditEvent{
+				Id:     claims.Id,
+				UserId: claims.UserId,
+				Reason: response.CodeInvalidClaims,
+			})
+			response.WriteError(writer, http.StatusUnauthorized, response.CodeInvalidClaims, err)
+			return
+		}
+		if cfg.bindToken {
+			clientIP := middleware.ClientIP(request, cfg.proxies)
+			if err := validateTokenBinding(claims, clientIP); err != nil {
+				cfg.metrics.increment(outcomeInvalid)
+				cfg.auditor.audit(request.Context(), AuditEvent{
+					Id:     claims.Id,
+					UserId: claims.UserId,
+					Reason: response.CodeBindingMismatch,
+				})
+				response.WriteError(writer, http.StatusUnauthorized, response.CodeBindingMismatch, err)
+				return
 			}
+		}
+		revoked, err := cfg.revocations.IsRevoked(revocationId(claims))
+		if err != nil {
+			cfg.metrics.increment(outcomeError)
+			response.WriteError(writer, http.StatusInternalServerError, response.CodeInternalError, err)
+			return
+		}
+		if revoked {
+			cfg.metrics.increment(outcomeRevoked)
+			cfg.auditor.audit(request.Context(), AuditEvent{
+				Id:     claims.Id,
+				UserId: claims.UserId,
+				Reason: response.CodeTokenRevoked,
+			})
+			response.WriteError(writer, http.StatusUnauthorized, response.CodeTokenRevoked, errors.New("token revoked"))
+			return
+		}
+		//the token is valid, it may still be forbidden by the claims
+		// validators (which is authorization rather than validation)
+		cfg.metrics.increment(outcomeOk)
+		if err := validateClaims(*claims, cfg.claimsValidators); err != nil {
+			cfg.auditor.audit(request.Context(), AuditEvent{
+				Id:     claims.Id,
+				UserId: claims.UserId,
+				Reason: response.CodeForbidden,
+			})
+			response.WriteError(writer, http.StatusForbidden, response.CodeForbidden, err)
+			return
+		}
+		user, err := mapClaims(*claims, cfg.claimsMapper)
+		if err != nil {
+			cfg.auditor.audit(request.Context(), AuditEvent{
+				Id:     claims.Id,
+				UserId: claims.UserId,
+				Reason: response.CodeForbidden,
+			})
+			response.WriteError(writer, http.StatusForbidden, response.CodeForbidden, err)
+			return
+		}
+		ctx := ctxkeys.WithClaims(request.Context(), *claims)
+		if user != nil {
+			ctx = ctxkeys.WithUser(ctx, user)
+		}
+		//tokens without a kid header are recorded with an empty kid
+		kid, _ := parsedToken.Header["kid"].(string)
+		ctx = ctxkeys.WithKid(ctx, kid)
+		//the token is only valid until it expires, so the work done on
+		// behalf of the token shouldn't outlive it
+		if claims.ExpiresAt != nil {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithDeadline(ctx, claims.ExpiresAt.Time)
+			defer cancel()
+		}
+		ctxkeys.Timings(ctx).Add("auth", time.Since(tAuth))
+		cfg.auditor.logicAuditing(ctx)
+		if cfg.successStatus == http.StatusNoContent {
+			writer.WriteHeader(http.StatusNoContent)
 			return
 		}
-		ctx := context.WithValue(request.Context(), keyCtxUserId, claims.UserId)
-		ctx = context.WithValue(ctx, keyCtxId, claims.Id)
-		logicAuditing(ctx)
 		if _, err := fmt.Fprintf(writer, "audit (%s); userId: %s\n", claims.Id, claims.UserId); err != nil {
 			fmt.Printf("error: %s\n", err.Error())
 		}
 	}
 }
 
-func logicAuditing(ctx context.Context) {
-	metaAuditing(ctx)
+// remainingBudget returns the time remaining (relative to now) until
+// the context's deadline, it returns false if there's no deadline
+func remainingBudget(ctx context.Context, now time.Time) (time.Duration, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	return deadline.Sub(now), true
+}
+
+func logBudget(ctx context.Context, layer string) {
+	if budget, ok := remainingBudget(ctx, time.Now()); ok {
+		deadline, _ := ctx.Deadline()
+		fmt.Printf("%s: remaining budget: %v (deadline: %s)\n", layer, budget, deadline.Format(time.RFC3339Nano))
+	}
+}
+
+func (a *auditor) logicAuditing(ctx context.Context) {
+	tLogic := time.Now()
+	logBudget(ctx, "logic")
+	ctxkeys.Timings(ctx).Add("logic", time.Since(tLogic))
+	a.metaAuditing(ctx)
 }
 
-func metaAuditing(ctx context.Context) {
-	id, userId := ctx.Value(keyCtxId), ctx.Value(keyCtxUserId)
-	fmt.Printf("audit (%s); userId: %s\n", id, userId)
+func (a *auditor) metaAuditing(ctx context.Context) {
+	tMeta := time.Now()
+	logBudget(ctx, "meta")
+	claims, _ := ClaimsFromContext(ctx)
+	a.audit(ctx, AuditEvent{
+		Id:     claims.Id,
+		UserId: claims.UserId,
+		Kid:    ctxkeys.Kid(ctx),
+	})
+	ctxkeys.Timings(ctx).Add("meta", time.Since(tMeta))
 }
 
-func Main(pwd string, args []string, envs map[string]string, osSignal chan os.Signal) error {
-	var httpAddress, httpPort, jwtKey string
-	var wg sync.WaitGroup
+// configure parses the configuration (args and environment) and creates
+// the dependencies of the server, if the audit events of a file should be
+// replayed (instead of serving), the replay function is returned
+func configure(args []string, envs map[string]string, o options) (server.Config, http.Handler, func() error, error) {
+	var requireHTTPS, trustedProxies, echoHeaders, requestIdHeader string
+	var corsOrigins string
+	var jwtKey, contentType, environment string
+	var jwtCookie, jwtSources, jwtAlg, jwtPublicKey string
+	var jwtAudience, jwtIssuer string
+	var auditFields, revokedFile, claimsNamespace, auditStream string
+	var auditReplay, revokeToken string
+	var debugBodies, jwtStrict, logJwtHeader bool
+	var enforceTokenBinding, auditIncludeQuery, failFast bool
+	var disallowQueryToken bool
+	var debugBodyLimit, auditSuccessStatus, tokenCacheSize, maxClaimLen int
+	var tokenCacheTTL, jwtLeeway time.Duration
+	var traceSample float64
+	var serverConfig server.Config
 	var err error
 
 	//get address/port from args
 	cli := flag.NewFlagSet("", flag.ContinueOnError)
-	cli.StringVar(&httpAddress, "address", "", "http address")
-	cli.StringVar(&httpPort, "port", "8080", "http port")
-	cli.StringVar(&jwtKey, "jwt_key", "secret", "jwt key")
+	serverConfig.Flags(cli)
+	cli.StringVar(&jwtKey, "jwt_key", defaultJwtKey, "jwt key")
+	cli.StringVar(&jwtAlg, "jwt_alg", jwtAlgHMAC, "jwt algorithm (HS256, EdDSA)")
+	cli.StringVar(&jwtPublicKey, "jwt_public_key", "", "path to the pem encoded public key (EdDSA)")
+	cli.StringVar(&jwtAudience, "jwt_audience", "", "audience required in the aud claim (empty doesn't validate the audience)")
+	cli.StringVar(&jwtIssuer, "jwt_issuer", "", "issuer required in the iss claim (empty doesn't validate the issuer)")
+	cli.DurationVar(&jwtLeeway, "jwt_leeway", 0, "leeway for clock skew when validating the exp, nbf and iat claims")
+	cli.StringVar(&jwtCookie, "jwt_cookie", "token", "name of the cookie containing the jwt")
+	cli.StringVar(&jwtSources, "jwt_sources", "header,cookie,query", "jwt sources in order of precedence (header, cookie, query, proxy)")
+	cli.BoolVar(&disallowQueryToken, "disallow_query_token", false, "ignore the query jwt source (tokens in the url can leak)")
+	cli.StringVar(&contentType, "content_type", middleware.DefaultContentType, "default response content type")
+	cli.StringVar(&requireHTTPS, "require_https", middleware.HTTPSModeDisabled, "redirect or reject requests not made over https")
+	cli.StringVar(&trustedProxies, "trusted_proxies", "", "comma separated ips/cidrs of proxies trusted to set X-Forwarded-Proto")
+	cli.StringVar(&corsOrigins, "cors_origins", "", "comma separated origins allowed to make cross-origin requests (e.g., the rest_context ui)")
+	cli.StringVar(&auditFields, "audit_fields", "", "audit field name mapping (e.g., user_id:userId,id:audit_id)")
+	cli.StringVar(&revokedFile, "revoked_file", "", "file with revoked token ids, the jti (or id) claim (one per line)")
+	cli.StringVar(&revokeToken, "revoke_token", "", "admin token required by /revoke (empty disables /revoke)")
+	cli.BoolVar(&debugBodies, "debug_bodies", false, "log (truncated) request and response bodies")
+	cli.Float64Var(&traceSample, "trace_sample", 0, "rate of requests sampled for debug logging (0-1), X-Debug is honored from trusted proxies")
+	cli.IntVar(&debugBodyLimit, "debug_body_limit", 1024, "maximum number of bytes logged for each body")
+	cli.IntVar(&auditSuccessStatus, "audit_success_status", http.StatusOK, "status returned on success (200 with a body, 204 without)")
+	cli.StringVar(&claimsNamespace, "claims_namespace", "", "namespace of custom claims (e.g., https://myapp/)")
+	cli.IntVar(&maxClaimLen, "max_claim_len", 256, "maximum length (in bytes) of string claims (0 is unlimited)")
+	cli.BoolVar(&jwtStrict, "jwt_strict", false, "require the typ header and the exp, iat and sub/user_id claims")
+	cli.BoolVar(&logJwtHeader, "log_jwt_header", false, "log the decoded jwt header (alg, typ, kid) of each token")
+	cli.BoolVar(&enforceTokenBinding, "enforce_token_binding", false, "require tokens to be bound to the client ip (cnf claim)")
+	cli.StringVar(&echoHeaders, "echo_headers", echo.DefaultHeaders, "comma separated headers reflected by /echo")
+	cli.StringVar(&auditStream, "audit_stream", auditStreamStdout, "stream audit events are written to (stdout, stderr)")
+	cli.StringVar(&requestIdHeader, "request_id_header", middleware.HeaderRequestId, "header the request id is read from and written to")
+	cli.BoolVar(&auditIncludeQuery, "audit_include_query", false, "include the (sanitized) query string in audit events")
+	cli.StringVar(&auditReplay, "audit_replay", "", "replay the audit events of the file (json lines) to the audit stream and exit")
+	cli.IntVar(&tokenCacheSize, "token_cache_size", 0, "maximum number of parsed tokens cached (0 disables the cache)")
+	cli.DurationVar(&tokenCacheTTL, "token_cache_ttl", time.Minute, "maximum duration a parsed token is cached (bounded by its expiration)")
+	cli.StringVar(&environment, "env", environmentDevelopment, "environment (development, production), production requires a non-default jwt key")
+	cli.BoolVar(&failFast, "fail_fast", false, "panic instead of returning an error on critical misconfiguration")
 	if err := cli.Parse(args); err != nil {
-		return err
+		return server.Config{}, nil, nil, err
 	}
 
 	//get address/port from env (overrides args)
-	if _, ok := envs["HTTP_PORT"]; ok {
-		httpPort = envs["HTTP_PORT"]
-	}
-	if _, ok := envs["HTTP_ADDRESS"]; ok {
-		httpAddress = envs["HTTP_ADDRESS"]
+	if err := serverConfig.Envs(envs); err != nil {
+		return server.Config{}, nil, nil, err
 	}
 	if _, ok := envs["JWT_KEY"]; ok {
 		jwtKey = envs["JWT_KEY"]
 	}
+	if _, ok := envs["JWT_ALG"]; ok {
+		jwtAlg = envs["JWT_ALG"]
+	}
+	if _, ok := envs["JWT_PUBLIC_KEY"]; ok {
+		jwtPublicKey = envs["JWT_PUBLIC_KEY"]
+	}
+	if _, ok := envs["JWT_AUDIENCE"]; ok {
+		jwtAudience = envs["JWT_AUDIENCE"]
+	}
+	if _, ok := envs["JWT_ISSUER"]; ok {
+		jwtIssuer = envs["JWT_ISSUER"]
+	}
+	if _, ok := envs["JWT_LEEWAY"]; ok {
+		if jwtLeeway, err = time.ParseDuration(envs["JWT_LEEWAY"]); err != nil {
+			return server.Config{}, nil, nil, err
+		}
+	}
+	if _, ok := envs["JWT_COOKIE"]; ok {
+		jwtCookie = envs["JWT_COOKIE"]
+	}
+	if _, ok := envs["JWT_SOURCES"]; ok {
+		jwtSources = envs["JWT_SOURCES"]
+	}
+	if _, ok := envs["DISALLOW_QUERY_TOKEN"]; ok {
+		if disallowQueryToken, err = strconv.ParseBool(envs["DISALLOW_QUERY_TOKEN"]); err != nil {
+			return server.Config{}, nil, nil, err
+		}
+	}
+	if _, ok := envs["CONTENT_TYPE"]; ok {
+		contentType = envs["CONTENT_TYPE"]
+	}
+	if _, ok := envs["REQUIRE_HTTPS"]; ok {
+		requireHTTPS = envs["REQUIRE_HTTPS"]
+	}
+	if _, ok := envs["TRUSTED_PROXIES"]; ok {
+		trustedProxies = envs["TRUSTED_PROXIES"]
+	}
+	if _, ok := envs["CORS_ORIGINS"]; ok {
+		corsOrigins = envs["CORS_ORIGINS"]
+	}
+	if _, ok := envs["DEBUG_BODIES"]; ok {
+		if debugBodies, err = strconv.ParseBool(envs["DEBUG_BODIES"]); err != nil {
+			return server.Config{}, nil, nil, err
+		}
+	}
+	if _, ok := envs["DEBUG_BODY_LIMIT"]; ok {
+		if debugBodyLimit, err = strconv.Atoi(envs["DEBUG_BODY_LIMIT"]); err != nil {
+			return server.Config{}, nil, nil, err
+		}
+	}
+	if _, ok := envs["AUDIT_FIELDS"]; ok {
+		auditFields = envs["AUDIT_FIELDS"]
+	}
+	if _, ok := envs["REVOKED_FILE"]; ok {
+		revokedFile = envs["REVOKED_FILE"]
+	}
+	if _, ok := envs["REVOKE_TOKEN"]; ok {
+		revokeToken = envs["REVOKE_TOKEN"]
+	}
+	if _, ok := envs["AUDIT_SUCCESS_STATUS"]; ok {
+		if auditSuccessStatus, err = strconv.Atoi(envs["AUDIT_SUCCESS_STATUS"]); err != nil {
+			return server.Config{}, nil, nil, err
+		}
+	}
+	if _, ok := envs["CLAIMS_NAMESPACE"]; ok {
+		claimsNamespace = envs["CLAIMS_NAMESPACE"]
+	}
+	if _, ok := envs["JWT_STRICT"]; ok {
+		if jwtStrict, err = strconv.ParseBool(envs["JWT_STRICT"]); err != nil {
+			return server.Config{}, nil, nil, err
+		}
+	}
+	if _, ok := envs["LOG_JWT_HEADER"]; ok {
+		if logJwtHeader, err = strconv.ParseBool(envs["LOG_JWT_HEADER"]); err != nil {
+			return server.Config{}, nil, nil, err
+		}
+	}
+	if _, ok := envs["ENFORCE_TOKEN_BINDING"]; ok {
+		if enforceTokenBinding, err = strconv.ParseBool(envs["ENFORCE_TOKEN_BINDING"]); err != nil {
+			return server.Config{}, nil, nil, err
+		}
+	}
+	if _, ok := envs["ECHO_HEADERS"]; ok {
+		echoHeaders = envs["ECHO_HEADERS"]
+	}
+	if _, ok := envs["AUDIT_STREAM"]; ok {
+		auditStream = envs["AUDIT_STREAM"]
+	}
+	if _, ok := envs["REQUEST_ID_HEADER"]; ok {
+		requestIdHeader = envs["REQUEST_ID_HEADER"]
+	}
+	if _, ok := envs["AUDIT_INCLUDE_QUERY"]; ok {
+		if auditIncludeQuery, err = strconv.ParseBool(envs["AUDIT_INCLUDE_QUERY"]); err != nil {
+			return server.Config{}, nil, nil, err
+		}
+	}
+	if _, ok := envs["TOKEN_CACHE_SIZE"]; ok {
+		if tokenCacheSize, err = strconv.Atoi(envs["TOKEN_CACHE_SIZE"]); err != nil {
+			return server.Config{}, nil, nil, err
+		}
+	}
+	if _, ok := envs["TOKEN_CACHE_TTL"]; ok {
+		if tokenCacheTTL, err = time.ParseDuration(envs["TOKEN_CACHE_TTL"]); err != nil {
+			return server.Config{}, nil, nil, err
+		}
+	}
+	if _, ok := envs["ENV"]; ok {
+		environment = envs["ENV"]
+	}
+	if _, ok := envs["FAIL_FAST"]; ok {
+		if failFast, err = strconv.ParseBool(envs["FAIL_FAST"]); err != nil {
+			return server.Config{}, nil, nil, err
+		}
+	}
+	if _, ok := envs["TRACE_SAMPLE"]; ok {
+		if traceSample, err = strconv.ParseFloat(envs["TRACE_SAMPLE"], 64); err != nil {
+			return server.Config{}, nil, nil, err
+		}
+	}
+	if _, ok := envs["MAX_CLAIM_LEN"]; ok {
+		if maxClaimLen, err = strconv.Atoi(envs["MAX_CLAIM_LEN"]); err != nil {
+			return server.Config{}, nil, nil, err
+		}
+	}
+	if _, ok := envs["AUDIT_REPLAY"]; ok {
+		auditReplay = envs["AUDIT_REPLAY"]
+	}
+	serverConfig.Sources = config.Sources(cli, envs, server.EnvNames)
+
+	//validate the configuration and create dependencies
+	if err := validateEnvironment(environment, jwtAlg, jwtKey); err != nil {
+		return server.Config{}, nil, nil, misconfigured(failFast, err)
+	}
+	proxies, err := middleware.ParseTrustedProxies(trustedProxies)
+	if err != nil {
+		return server.Config{}, nil, nil, err
+	}
+	httpsOnly, err := middleware.HTTPSOnly(requireHTTPS, proxies, server.AdminPaths...)
+	if err != nil {
+		return server.Config{}, nil, nil, err
+	}
+	sample, err := middleware.Sample(traceSample, proxies)
+	if err != nil {
+		return server.Config{}, nil, nil, err
+	}
+	keyFunc, err := newKeyFunc(jwtAlg, jwtKey, jwtPublicKey)
+	if err != nil {
+		return server.Config{}, nil, nil, err
+	}
+	parser := newTokenParser(
+		withAllowedAlgs(jwtAlg),
+		withAudience(jwtAudience),
+		withIssuer(jwtIssuer),
+		withLeeway(jwtLeeway),
+	)
+	extractor, err := newTokenExtractor(jwtCookie, jwtSources, disallowQueryToken)
+	if err != nil {
+		return server.Config{}, nil, nil, err
+	}
+	fieldNames, err := parseAuditFields(auditFields)
+	if err != nil {
+		return server.Config{}, nil, nil, err
+	}
+	auditOutput, err := auditWriter(auditStream)
+	if err != nil {
+		return server.Config{}, nil, nil, err
+	}
+	auditor := newAuditor(auditOutput, fieldNames)
+	if auditReplay != "" {
+		//replaying is separate from serving, the events are replayed
+		// and the application exits
+		return serverConfig, nil, func() error {
+			return replayAuditFile(auditReplay, auditor)
+		}, nil
+	}
+	revokedIds, err := readRevokedFile(revokedFile)
+	if err != nil {
+		return server.Config{}, nil, nil, err
+	}
+	revocations := newMemoryRevocationStore(revokedIds...)
+	if err := validateSuccessStatus(auditSuccessStatus); err != nil {
+		return server.Config{}, nil, nil, err
+	}
+	var cache *tokenCache
+	if tokenCacheSize > 0 {
+		cache = newTokenCache(tokenCacheSize, tokenCacheTTL)
+	}
+	var validators []tokenValidator
+	if jwtStrict {
+		validators = strictValidators
+	}
 
 	//generate and create handle func, when connecting, it will use this port
 	// indicate via console that the webserver is starting
-	http.HandleFunc("/token", endpointToken(jwtKey))
-	server := &http.Server{
-		Addr:    httpAddress + ":" + httpPort,
-		Handler: nil,
-	}
-	fmt.Printf("starting web server on %s:%s\n", httpAddress, httpPort)
-	stopped := make(chan struct{})
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		defer close(stopped)
-
-		if err = server.ListenAndServe(); err != nil {
-			return
-		}
-	}()
-	select {
-	case <-stopped:
-	case <-osSignal:
-		err = server.Close()
+	// use a local mux (rather than the default mux) so multiple servers
+	// can co-exist within the same process
+	mux := http.NewServeMux()
+	metrics := newValidationMetrics()
+	mux.HandleFunc("/token", endpointToken(tokenConfig{
+		keyFunc:          keyFunc,
+		parser:           parser,
+		claimsValidators: o.claimsValidators,
+		claimsMapper:     o.claimsMapper,
+		extractor:        extractor,
+		auditor:          auditor,
+		revocations:      revocations,
+		successStatus:    auditSuccessStatus,
+		namespace:        claimsNamespace,
+		validators:       validators,
+		logHeader:        logJwtHeader,
+		bindToken:        enforceTokenBinding,
+		proxies:          proxies,
+		includeQuery:     auditIncludeQuery,
+		cache:            cache,
+		maxClaimLen:      maxClaimLen,
+		metrics:          metrics,
+	}))
+	mux.HandleFunc("/metrics", endpointMetrics(metrics))
+	//the route is registered regardless so it's clear that it's disabled
+	// (rather than falling through) when there's no admin token
+	if revokeToken != "" {
+		mux.HandleFunc("/revoke", endpointRevoke(revocations, revokeToken))
+	} else {
+		mux.Handle("/revoke", http.NotFoundHandler())
+	}
+	mux.HandleFunc("/echo", echo.Handler(echo.ParseHeaders(echoHeaders)))
+	serverConfig.Middleware = []middleware.Middleware{
+		middleware.CORS(corsOrigins),
+		httpsOnly,
+		middleware.RequestId(requestIdHeader, uuid.NewString),
+		middleware.Proto,
+		middleware.ServerTiming,
+		sample,
+		middleware.ContentType(contentType),
+		middleware.DebugBodies(debugBodies, debugBodyLimit),
+	}
+	serverConfig.OnStopped = o.onStopped
+	serverConfig.Summary = map[string]any{
+		"jwt_key":               config.Redact(jwtKey),
+		"env":                   environment,
+		"fail_fast":             failFast,
+		"jwt_alg":               jwtAlg,
+		"jwt_audience":          jwtAudience,
+		"jwt_issuer":            jwtIssuer,
+		"jwt_leeway":            jwtLeeway.String(),
+		"jwt_public_key":        jwtPublicKey,
+		"jwt_cookie":            jwtCookie,
+		"jwt_sources":           jwtSources,
+		"disallow_query_token":  disallowQueryToken,
+		"content_type":          contentType,
+		"require_https":         requireHTTPS,
+		"trusted_proxies":       trustedProxies,
+		"cors_origins":          corsOrigins,
+		"trace_sample":          traceSample,
+		"debug_bodies":          debugBodies,
+		"debug_body_limit":      debugBodyLimit,
+		"audit_fields":          auditFields,
+		"revoked_file":          revokedFile,
+		"revoke_token":          config.Redact(revokeToken),
+		"audit_success_status":  auditSuccessStatus,
+		"claims_namespace":      claimsNamespace,
+		"jwt_strict":            jwtStrict,
+		"max_claim_len":         maxClaimLen,
+		"log_jwt_header":        logJwtHeader,
+		"enforce_token_binding": enforceTokenBinding,
+		"request_id_header":     requestIdHeader,
+		"echo_headers":          echoHeaders,
+		"audit_stream":          auditStream,
+		"audit_include_query":   auditIncludeQuery,
+		"token_cache_size":      tokenCacheSize,
+		"token_cache_ttl":       tokenCacheTTL.String(),
+	}
+	return serverConfig, mux, nil, nil
+}
+
+func Main(pwd string, args []string, envs map[string]string, osSignal chan os.Signal, opts ...Option) error {
+	var o options
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+	serverConfig, handler, replay, err := configure(args, envs, o)
+	if err != nil {
+		return err
+	}
+	if replay != nil {
+		return replay()
+	}
+	return server.Run(serverConfig, handler, osSignal)
+}
+
+// Config is the configuration of the application as it's provided to
+// Main (the args and the environment) along with its options
+type Config struct {
+	Args    []string
+	Envs    map[string]string
+	Options []Option
+}
+
+// NewTestHandler returns the handler served by Main (the endpoints, the
+// admin endpoints and the middleware) without a listener so the whole
+// server can be tested in memory (e.g., with httptest.NewServer)
+func NewTestHandler(cfg Config) (http.Handler, error) {
+	var o options
+
+	for _, opt := range cfg.Options {
+		opt(&o)
+	}
+	serverConfig, handler, replay, err := configure(cfg.Args, cfg.Envs, o)
+	if err != nil {
+		return nil, err
+	}
+	if replay != nil {
+		return nil, errors.New("audit_replay doesn't serve a handler")
 	}
-	wg.Wait()
-	return err
+	return server.Handler(serverConfig, handler)
 }
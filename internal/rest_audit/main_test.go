@@ -0,0 +1,357 @@
+package rest_audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/antonio-alexander/go-blog-context/internal/config"
+	"github.com/antonio-alexander/go-blog-context/internal/middleware"
+	"github.com/antonio-alexander/go-blog-context/internal/response"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const testJwtKey string = "secret"
+
+// newTestTokenConfig returns the default configuration of the audit
+// endpoint (audit events are discarded)
+func newTestTokenConfig(t *testing.T) tokenConfig {
+	t.Helper()
+
+	keyFunc, err := newKeyFunc(jwtAlgHMAC, testJwtKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	extractor, err := newTokenExtractor("token", "header", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokenConfig{
+		keyFunc:       keyFunc,
+		parser:        newTokenParser(withAllowedAlgs(jwtAlgHMAC)),
+		extractor:     extractor,
+		auditor:       newAuditor(io.Discard, nil),
+		revocations:   newMemoryRevocationStore(),
+		successStatus: http.StatusOK,
+	}
+}
+
+// newTestToken signs the claims with the test key, the token expires
+// in a minute unless an expiration is set
+func newTestToken(t *testing.T, claims Claims) string {
+	t.Helper()
+
+	return newTestTokenWithHeader(t, claims, nil)
+}
+
+// newTestTokenWithHeader signs the claims with the test key and adds
+// the header fields (e.g., kid) to the token's header
+func newTestTokenWithHeader(t *testing.T, claims Claims, header map[string]any) string {
+	t.Helper()
+
+	if claims.ExpiresAt == nil {
+		claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Minute))
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	for key, value := range header {
+		token.Header[key] = value
+	}
+	signedToken, err := token.SignedString([]byte(testJwtKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signedToken
+}
+
+// serveToken serves a request with the token (if not empty) to the
+// audit endpoint
+func serveToken(cfg tokenConfig, token string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, "/token", nil)
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	endpointToken(cfg)(recorder, request)
+	return recorder
+}
+
+// newTestServer serves the whole application (as built by NewTestHandler
+// with the args) without Main's lifecycle
+func newTestServer(t *testing.T, args ...string) *httptest.Server {
+	t.Helper()
+
+	handler, err := NewTestHandler(Config{Args: args, Envs: map[string]string{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testServer := httptest.NewServer(handler)
+	t.Cleanup(testServer.Close)
+	return testServer
+}
+
+// getToken requests the audit endpoint of the test server with the
+// token as a bearer token
+func getToken(t *testing.T, testServer *httptest.Server, token string) *http.Response {
+	t.Helper()
+
+	request, err := http.NewRequest(http.MethodGet, testServer.URL+"/token", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Authorization", "Bearer "+token)
+	response, err := testServer.Client().Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { response.Body.Close() })
+	return response
+}
+
+func TestNewTestHandler(t *testing.T) {
+	testServer := newTestServer(t)
+	response := getToken(t, testServer, newTestToken(t, Claims{UserId: "user", Id: "id"}))
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, response.StatusCode)
+	}
+	if response.Header.Get(middleware.HeaderRequestId) == "" {
+		t.Fatal("expected the request id middleware to be applied")
+	}
+	response, err := testServer.Client().Get(testServer.URL + "/readyz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("expected the admin endpoints to be served, got %d", response.StatusCode)
+	}
+
+	if _, err := NewTestHandler(Config{Args: []string{"-audit_replay", "audit.jsonl"}}); err == nil {
+		t.Fatal("expected an error when replaying")
+	}
+}
+
+// captureStdout returns what's written to stdout while fn is executed
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+
+	return captureOutput(t, &os.Stdout, fn)
+}
+
+// captureOutput returns what's written to the file (e.g., stdout or
+// stderr) while fn is executed
+func captureOutput(t *testing.T, file **os.File, fn func()) string {
+	t.Helper()
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := *file
+	*file = writer
+	defer func() { *file = original }()
+	output := make(chan string)
+	go func() {
+		bytes, _ := io.ReadAll(reader)
+		output <- string(bytes)
+	}()
+	fn()
+	writer.Close()
+	return <-output
+}
+
+// auditEvents returns the audit events (json lines) of the output
+func auditEvents(output string) []AuditEvent {
+	var events []AuditEvent
+
+	for _, line := range strings.Split(output, "\n") {
+		var event AuditEvent
+		if err := json.Unmarshal([]byte(line), &event); err == nil && event.Path != "" {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+func TestDeadlinePropagation(t *testing.T) {
+	//the deadline of the inbound request (earlier than the token's
+	// expiration) must be observed by each layer
+	deadline := time.Now().Add(30 * time.Second)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	request := httptest.NewRequest(http.MethodGet, "/token", nil).WithContext(ctx)
+	request.Header.Set("Authorization", "Bearer "+newTestToken(t, Claims{UserId: "user", Id: "id"}))
+	output := captureStdout(t, func() {
+		endpointToken(newTestTokenConfig(t))(httptest.NewRecorder(), request)
+	})
+	deadlines := map[string]string{}
+	for _, match := range regexp.MustCompile(`(?m)^(\w+): remaining budget: .* \(deadline: (.*)\)$`).FindAllStringSubmatch(output, -1) {
+		deadlines[match[1]] = match[2]
+	}
+	expected := deadline.Format(time.RFC3339Nano)
+	for _, layer := range []string{"logic", "meta"} {
+		if deadlines[layer] != expected {
+			t.Fatalf("%s: expected deadline %s, got %q", layer, expected, deadlines[layer])
+		}
+	}
+}
+
+// decodeError decodes the json error envelope of the response
+func decodeError(t *testing.T, recorder *httptest.ResponseRecorder) response.Error {
+	t.Helper()
+
+	var e response.Error
+	if err := json.NewDecoder(recorder.Body).Decode(&e); err != nil {
+		t.Fatalf("expected a json error envelope, got %q: %s", recorder.Body.String(), err)
+	}
+	return e
+}
+
+func TestTokenType(t *testing.T) {
+	for name, c := range map[string]struct {
+		claims     Claims
+		header     map[string]any
+		statusCode int
+	}{
+		"access":       {claims: Claims{UserId: "user", TokenUse: "access"}, statusCode: http.StatusOK},
+		"unspecified":  {claims: Claims{UserId: "user"}, statusCode: http.StatusOK},
+		"refresh":      {claims: Claims{UserId: "user", TokenUse: "refresh"}, statusCode: http.StatusUnauthorized},
+		"typ_jwt":      {claims: Claims{UserId: "user"}, header: map[string]any{"typ": "jwt"}, statusCode: http.StatusOK},
+		"typ_refresh":  {claims: Claims{UserId: "user"}, header: map[string]any{"typ": "refresh+jwt"}, statusCode: http.StatusUnauthorized},
+		"typ_and_user": {claims: Claims{UserId: "user", TokenUse: "refresh"}, header: map[string]any{"typ": "JWT"}, statusCode: http.StatusUnauthorized},
+	} {
+		var output bytes.Buffer
+		cfg := newTestTokenConfig(t)
+		cfg.auditor = newAuditor(&output, nil)
+		recorder := serveToken(cfg, newTestTokenWithHeader(t, c.claims, c.header))
+		if recorder.Code != c.statusCode {
+			t.Fatalf("%s: expected %d, got %d", name, c.statusCode, recorder.Code)
+		}
+		if c.statusCode == http.StatusOK {
+			continue
+		}
+		if e := decodeError(t, recorder); e.Code != response.CodeWrongTokenType {
+			t.Fatalf("%s: expected code %q, got %q", name, response.CodeWrongTokenType, e.Code)
+		}
+		//the misuse is audited
+		if events := auditEvents(output.String()); len(events) != 1 || events[0].Reason != response.CodeWrongTokenType {
+			t.Fatalf("%s: expected the misuse to be audited, got %+v", name, events)
+		}
+	}
+}
+
+func TestRemainingBudget(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if _, ok := remainingBudget(context.Background(), now); ok {
+		t.Fatal("expected no budget without a deadline")
+	}
+	ctx, cancel := context.WithDeadline(context.Background(), now.Add(1500*time.Millisecond))
+	defer cancel()
+	if budget, ok := remainingBudget(ctx, now); !ok || budget != 1500*time.Millisecond {
+		t.Fatalf("expected 1.5s, got %v (%t)", budget, ok)
+	}
+	if budget, _ := remainingBudget(ctx, now.Add(2*time.Second)); budget != -500*time.Millisecond {
+		t.Fatalf("expected -500ms once the deadline has passed, got %v", budget)
+	}
+}
+
+func TestConfigSummaryRedacted(t *testing.T) {
+	//the summary (written as the server.config event and served by
+	// /config) mustn't include secrets
+	const jwtKey, revokeToken string = "jwt-key-secret", "revoke-token-secret"
+
+	testServer := newTestServer(t, "-jwt_key", jwtKey, "-revoke_token", revokeToken)
+	response, err := testServer.Client().Get(testServer.URL + "/config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(body), jwtKey) || strings.Contains(string(body), revokeToken) {
+		t.Fatalf("expected the secrets to be redacted: %s", body)
+	}
+	var cfg struct {
+		Config map[string]any `json:"config"`
+	}
+	if err := json.Unmarshal(body, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Config["jwt_key"] != config.Redacted || cfg.Config["revoke_token"] != config.Redacted {
+		t.Fatalf("unexpected secrets: %v, %v", cfg.Config["jwt_key"], cfg.Config["revoke_token"])
+	}
+	if cfg.Config["jwt_alg"] != jwtAlgHMAC {
+		t.Fatalf("expected the non-secret config, got %v", cfg.Config["jwt_alg"])
+	}
+}
+
+func TestAuditSuccessStatus(t *testing.T) {
+	signedToken := newTestToken(t, Claims{UserId: "user", Id: "id"})
+	for _, c := range []struct {
+		status string
+		code   int
+		body   string
+	}{
+		{"200", http.StatusOK, "audit (id); userId: user\n"},
+		{"204", http.StatusNoContent, ""},
+	} {
+		testServer := newTestServer(t, "-audit_success_status", c.status)
+		response := getToken(t, testServer, signedToken)
+		body, err := io.ReadAll(response.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.StatusCode != c.code || string(body) != c.body {
+			t.Fatalf("%s: expected %d %q, got %d %q", c.status, c.code, c.body, response.StatusCode, body)
+		}
+	}
+	for _, status := range []string{"201", "500"} {
+		if _, err := NewTestHandler(Config{Args: []string{"-audit_success_status", status}}); err == nil {
+			t.Fatalf("expected an error for %s", status)
+		}
+	}
+}
+
+func TestServerTiming(t *testing.T) {
+	response := getToken(t, newTestServer(t), newTestToken(t, Claims{UserId: "user", Id: "id"}))
+	header := response.Header.Get(middleware.HeaderServerTiming)
+	if !regexp.MustCompile(`^auth;dur=\d+\.\d{3}, logic;dur=\d+\.\d{3}, meta;dur=\d+\.\d{3}$`).MatchString(header) {
+		t.Fatalf("expected the auth, logic and meta phases, got %q", header)
+	}
+}
+
+func TestCORSOrigins(t *testing.T) {
+	//the demo ui (served by rest_context) calls the audit endpoint
+	// from another origin, the preflight allows the authorization header
+	testServer := newTestServer(t, "-cors_origins", "http://localhost:8080")
+	request, err := http.NewRequest(http.MethodOptions, testServer.URL+"/token", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Origin", "http://localhost:8080")
+	request.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	response, err := testServer.Client().Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected %d, got %d", http.StatusNoContent, response.StatusCode)
+	}
+	if origin := response.Header.Get("Access-Control-Allow-Origin"); origin != "http://localhost:8080" {
+		t.Fatalf("expected the origin to be allowed, got %q", origin)
+	}
+	if headers := response.Header.Get("Access-Control-Allow-Headers"); !strings.Contains(headers, "Authorization") {
+		t.Fatalf("expected the authorization header to be allowed, got %q", headers)
+	}
+}
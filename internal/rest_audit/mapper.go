@@ -0,0 +1,27 @@
+package rest_audit
+
+import (
+	"context"
+
+	"github.com/antonio-alexander/go-blog-context/internal/ctxkeys"
+)
+
+// ClaimsMapper maps the validated claims to a domain object (e.g., a
+// user), it's executed after the claims have been validated; a non-nil
+// error rejects the token
+type ClaimsMapper func(Claims) (any, error)
+
+// mapClaims executes the mapper (if set), if the mapper isn't set,
+// nil is returned
+func mapClaims(claims Claims, mapper ClaimsMapper) (any, error) {
+	if mapper == nil {
+		return nil, nil
+	}
+	return mapper(claims)
+}
+
+// UserFromContext returns the result of the claims mapper stored in
+// the context, nil is returned if there's no mapper
+func UserFromContext(ctx context.Context) any {
+	return ctxkeys.User(ctx)
+}
@@ -0,0 +1,39 @@
+package rest_audit
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestClaimsMapper(t *testing.T) {
+	type user struct {
+		Id string
+	}
+	var mapped []string
+
+	cfg := newTestTokenConfig(t)
+	cfg.claimsMapper = func(claims Claims) (any, error) {
+		mapped = append(mapped, claims.UserId)
+		if claims.UserId == "unknown" {
+			return nil, errors.New("unknown user")
+		}
+		return user{Id: claims.UserId}, nil
+	}
+	if recorder := serveToken(cfg, newTestToken(t, Claims{Id: "id", UserId: "user"})); recorder.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, recorder.Code)
+	}
+	if recorder := serveToken(cfg, newTestToken(t, Claims{Id: "id", UserId: "unknown"})); recorder.Code != http.StatusForbidden {
+		t.Fatalf("expected %d, got %d", http.StatusForbidden, recorder.Code)
+	}
+	if len(mapped) != 2 || mapped[0] != "user" || mapped[1] != "unknown" {
+		t.Fatalf("expected the claims to be mapped, got %v", mapped)
+	}
+}
+
+func TestClaimsMapperNotSet(t *testing.T) {
+	value, err := mapClaims(Claims{UserId: "user"}, nil)
+	if err != nil || value != nil {
+		t.Fatalf("expected nil, got %v (%v)", value, err)
+	}
+}
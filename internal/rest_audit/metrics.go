@@ -0,0 +1,86 @@
+package rest_audit
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+
+	"github.com/antonio-alexander/go-blog-context/internal/response"
+)
+
+const metricJwtValidation string = "jwt_validation_total"
+
+const (
+	outcomeOk          string = "ok"
+	outcomeExpired     string = "expired"
+	outcomeSignature   string = "bad_signature"
+	outcomeNotYetValid string = "not_yet_valid"
+	outcomeMalformed   string = "malformed"
+	outcomeRevoked     string = "revoked"
+	outcomeInvalid     string = "invalid"
+	outcomeError       string = "error"
+)
+
+// jwtOutcomes maps the error codes returned by classifyJWTError to the
+// outcome counted by jwt_validation_total, the outcome is derived from
+// the same code as the response so they're always consistent
+var jwtOutcomes = map[string]string{
+	response.CodeTokenExpired:     outcomeExpired,
+	response.CodeTokenNotValidYet: outcomeNotYetValid,
+	response.CodeInvalidSignature: outcomeSignature,
+	response.CodeMalformedToken:   outcomeMalformed,
+	response.CodeInvalidToken:     outcomeInvalid,
+	response.CodeInternalError:    outcomeError,
+}
+
+func jwtOutcome(code string) string {
+	if outcome, ok := jwtOutcomes[code]; ok {
+		return outcome
+	}
+	return outcomeError
+}
+
+// validationMetrics counts the outcome of validating each token, the
+// counters aren't published (expvar.Publish) so each application (e.g.,
+// in tests) has its own
+type validationMetrics struct {
+	total *expvar.Map
+}
+
+func newValidationMetrics() *validationMetrics {
+	total := new(expvar.Map).Init()
+	for _, outcome := range []string{outcomeOk, outcomeExpired, outcomeSignature,
+		outcomeNotYetValid, outcomeMalformed, outcomeRevoked, outcomeInvalid, outcomeError} {
+		total.Add(outcome, 0)
+	}
+	return &validationMetrics{total: total}
+}
+
+// increment counts the outcome, it's a no-op if the metrics are nil
+func (v *validationMetrics) increment(outcome string) {
+	if v == nil {
+		return
+	}
+	v.total.Add(outcome, 1)
+}
+
+// counts returns the count of each outcome
+func (v *validationMetrics) counts() map[string]int64 {
+	counts := make(map[string]int64)
+	v.total.Do(func(kv expvar.KeyValue) {
+		counts[kv.Key] = kv.Value.(*expvar.Int).Value()
+	})
+	return counts
+}
+
+// endpointMetrics serves the metrics as json (e.g., {"jwt_validation_total":
+// {"ok":1,"expired":0,...}})
+func endpointMetrics(metrics *validationMetrics) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if err := response.NewEncoder(writer, request).Encode(map[string]any{
+			metricJwtValidation: metrics.counts(),
+		}); err != nil {
+			fmt.Printf("error: %s\n", err.Error())
+		}
+	}
+}
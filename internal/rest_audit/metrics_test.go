@@ -0,0 +1,71 @@
+package rest_audit
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestValidationMetrics(t *testing.T) {
+	past, future := jwt.NewNumericDate(time.Now().Add(-time.Minute)), jwt.NewNumericDate(time.Now().Add(time.Minute))
+	otherKey, err := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{Id: "id"}).SignedString([]byte("other"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for outcome, token := range map[string]string{
+		outcomeOk:          newTestToken(t, Claims{UserId: "user", Id: "id"}),
+		outcomeExpired:     newTestToken(t, Claims{RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: past}}),
+		outcomeNotYetValid: newTestToken(t, Claims{RegisteredClaims: jwt.RegisteredClaims{NotBefore: future}}),
+		outcomeSignature:   otherKey,
+		outcomeMalformed:   "not-a-token",
+		outcomeRevoked:     newTestToken(t, Claims{Id: "revoked"}),
+		outcomeInvalid:     newTestTokenWithHeader(t, Claims{Id: "id"}, map[string]any{"typ": "refresh+jwt"}),
+	} {
+		cfg := newTestTokenConfig(t)
+		cfg.revocations = newMemoryRevocationStore("revoked")
+		cfg.metrics = newValidationMetrics()
+		recorder := serveToken(cfg, token)
+		//only the outcome's label is incremented
+		for label, count := range cfg.metrics.counts() {
+			expected := int64(0)
+			if label == outcome {
+				expected = 1
+			}
+			if count != expected {
+				t.Fatalf("%s: expected %s to be %d, got %d", outcome, label, expected, count)
+			}
+		}
+		//the outcome is consistent with the response
+		if ok := recorder.Code == http.StatusOK; ok != (outcome == outcomeOk) {
+			t.Fatalf("%s: unexpected status %d", outcome, recorder.Code)
+		}
+		if outcome == outcomeOk {
+			continue
+		}
+		if e := decodeError(t, recorder); jwtOutcomes[e.Code] != "" && jwtOutcomes[e.Code] != outcome {
+			t.Fatalf("%s: inconsistent code %q", outcome, e.Code)
+		}
+	}
+}
+
+func TestEndpointMetrics(t *testing.T) {
+	testServer := newTestServer(t)
+	getToken(t, testServer, newTestToken(t, Claims{UserId: "user", Id: "id"}))
+	getToken(t, testServer, "not-a-token")
+	response, err := testServer.Client().Get(testServer.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	var metrics map[string]map[string]int64
+	if err := json.NewDecoder(response.Body).Decode(&metrics); err != nil {
+		t.Fatal(err)
+	}
+	total := metrics[metricJwtValidation]
+	if total[outcomeOk] != 1 || total[outcomeMalformed] != 1 || total[outcomeExpired] != 0 {
+		t.Fatalf("unexpected metrics: %v", total)
+	}
+}
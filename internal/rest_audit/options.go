@@ -0,0 +1,38 @@
+package rest_audit
+
+import "context"
+
+// Option configures Main beyond its flags and environment (e.g., when
+// the application is embedded)
+type Option func(*options)
+
+type options struct {
+	claimsValidators []ClaimsValidator
+	claimsMapper     ClaimsMapper
+	onStopped        func(ctx context.Context) error
+}
+
+// WithClaimsValidator adds a validator that's executed (in the order
+// they're added) for every token validated by the audit endpoint
+func WithClaimsValidator(validator ClaimsValidator) Option {
+	return func(o *options) {
+		o.claimsValidators = append(o.claimsValidators, validator)
+	}
+}
+
+// WithClaimsMapper sets the mapper executed for every token validated
+// by the audit endpoint, the result is available via UserFromContext
+func WithClaimsMapper(mapper ClaimsMapper) Option {
+	return func(o *options) {
+		o.claimsMapper = mapper
+	}
+}
+
+// WithOnStopped sets a function that's executed once the server has
+// stopped serving (before Main returns), its context has the deadline
+// of the shutdown (e.g., to flush buffers or close resources)
+func WithOnStopped(onStopped func(ctx context.Context) error) Option {
+	return func(o *options) {
+		o.onStopped = onStopped
+	}
+}
@@ -0,0 +1,109 @@
+package rest_audit
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// parserOption configures the token parser
+type parserOption func(*tokenParser)
+
+// withAudience requires the aud claim to contain the audience
+func withAudience(audience string) parserOption {
+	return func(p *tokenParser) {
+		p.audience = audience
+	}
+}
+
+// withIssuer requires the iss claim to be the issuer
+func withIssuer(issuer string) parserOption {
+	return func(p *tokenParser) {
+		p.issuer = issuer
+	}
+}
+
+// withLeeway allows for clock skew when validating the exp, nbf and
+// iat claims
+func withLeeway(leeway time.Duration) parserOption {
+	return func(p *tokenParser) {
+		p.leeway = leeway
+	}
+}
+
+// withAllowedAlgs limits the signing algorithms (alg header) accepted
+func withAllowedAlgs(algs ...string) parserOption {
+	return func(p *tokenParser) {
+		p.algs = algs
+	}
+}
+
+// tokenParser parses and validates tokens, the claims are validated by
+// the token parser (rather than the jwt parser) so that the leeway,
+// audience and issuer can be applied
+type tokenParser struct {
+	parser   *jwt.Parser
+	audience string
+	issuer   string
+	leeway   time.Duration
+	algs     []string
+}
+
+func newTokenParser(options ...parserOption) *tokenParser {
+	p := &tokenParser{}
+	for _, option := range options {
+		option(p)
+	}
+	jwtOptions := []jwt.ParserOption{jwt.WithoutClaimsValidation()}
+	if len(p.algs) > 0 {
+		jwtOptions = append(jwtOptions, jwt.WithValidMethods(p.algs))
+	}
+	p.parser = jwt.NewParser(jwtOptions...)
+	return p
+}
+
+// parse parses the token (verifying its signature) and validates its
+// claims, validation errors wrap the jwt errors (e.g., ErrTokenExpired)
+func (p *tokenParser) parse(token string, claims *Claims, keyFunc jwt.Keyfunc) (*jwt.Token, error) {
+	parsedToken, err := p.parser.ParseWithClaims(token, claims, keyFunc)
+	if err != nil {
+		return parsedToken, err
+	}
+	if err := p.validateClaims(claims, time.Now()); err != nil {
+		parsedToken.Valid = false
+		return parsedToken, err
+	}
+	return parsedToken, nil
+}
+
+func (p *tokenParser) validateClaims(claims *Claims, now time.Time) error {
+	switch {
+	case !claims.VerifyExpiresAt(now.Add(-p.leeway), false):
+		return &jwt.ValidationError{
+			Inner:  fmt.Errorf("%w by %s", jwt.ErrTokenExpired, now.Sub(claims.ExpiresAt.Time)),
+			Errors: jwt.ValidationErrorExpired,
+		}
+	case !claims.VerifyIssuedAt(now.Add(p.leeway), false):
+		return &jwt.ValidationError{
+			Inner:  jwt.ErrTokenUsedBeforeIssued,
+			Errors: jwt.ValidationErrorIssuedAt,
+		}
+	case !claims.VerifyNotBefore(now.Add(p.leeway), false):
+		return &jwt.ValidationError{
+			Inner:  jwt.ErrTokenNotValidYet,
+			Errors: jwt.ValidationErrorNotValidYet,
+		}
+	case p.audience != "" && !claims.VerifyAudience(p.audience, true):
+		return &jwt.ValidationError{
+			Inner:  jwt.ErrTokenInvalidAudience,
+			Errors: jwt.ValidationErrorAudience,
+		}
+	case p.issuer != "" && !claims.VerifyIssuer(p.issuer, true):
+		return &jwt.ValidationError{
+			Inner:  jwt.ErrTokenInvalidIssuer,
+			Errors: jwt.ValidationErrorIssuer,
+		}
+	}
+	return nil
+}
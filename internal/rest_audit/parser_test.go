@@ -0,0 +1,52 @@
+package rest_audit
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestTokenParserOptions(t *testing.T) {
+	keyFunc := func(*jwt.Token) (interface{}, error) { return []byte(testJwtKey), nil }
+	tNow := time.Now()
+	expired := Claims{}
+	expired.ExpiresAt = jwt.NewNumericDate(tNow.Add(-5 * time.Second))
+	audience := Claims{}
+	audience.Audience = jwt.ClaimStrings{"audience"}
+	issuer := Claims{}
+	issuer.Issuer = "issuer"
+
+	for _, c := range []struct {
+		name    string
+		options []parserOption
+		claims  Claims
+		err     error
+	}{
+		{"none", nil, Claims{}, nil},
+		{"expired", nil, expired, jwt.ErrTokenExpired},
+		{"leeway", []parserOption{withLeeway(10 * time.Second)}, expired, nil},
+		{"audience", []parserOption{withAudience("audience")}, audience, nil},
+		{"wrong_audience", []parserOption{withAudience("other")}, audience, jwt.ErrTokenInvalidAudience},
+		{"missing_audience", []parserOption{withAudience("audience")}, Claims{}, jwt.ErrTokenInvalidAudience},
+		{"issuer", []parserOption{withIssuer("issuer")}, issuer, nil},
+		{"wrong_issuer", []parserOption{withIssuer("other")}, issuer, jwt.ErrTokenInvalidIssuer},
+		{"allowed_alg", []parserOption{withAllowedAlgs(jwtAlgHMAC)}, Claims{}, nil},
+		{"disallowed_alg", []parserOption{withAllowedAlgs(jwtAlgEdDSA)}, Claims{}, jwt.ErrTokenSignatureInvalid},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			signedToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, c.claims).SignedString([]byte(testJwtKey))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = newTokenParser(c.options...).parse(signedToken, &Claims{}, keyFunc)
+			if c.err == nil && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if c.err != nil && !errors.Is(err, c.err) {
+				t.Fatalf("expected %v, got %v", c.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package rest_audit
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/antonio-alexander/go-blog-context/internal/response"
+)
+
+// RevocationStore tracks revoked tokens by their id, jwts can't be
+// revoked on their own so a blocklist must be checked for every token
+type RevocationStore interface {
+	Revoke(id string) error
+	IsRevoked(id string) (bool, error)
+}
+
+type memoryRevocationStore struct {
+	sync.RWMutex
+	revoked map[string]struct{}
+}
+
+func newMemoryRevocationStore(ids ...string) *memoryRevocationStore {
+	m := &memoryRevocationStore{revoked: make(map[string]struct{})}
+	for _, id := range ids {
+		m.revoked[id] = struct{}{}
+	}
+	return m
+}
+
+func (m *memoryRevocationStore) Revoke(id string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	m.revoked[id] = struct{}{}
+	return nil
+}
+
+func (m *memoryRevocationStore) IsRevoked(id string) (bool, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	_, revoked := m.revoked[id]
+	return revoked, nil
+}
+
+// readRevokedFile reads the revoked token ids from a file with one id
+// per line, empty lines and lines starting with # are ignored (lines
+// that are too long are logged and skipped)
+func readRevokedFile(path string) ([]string, error) {
+	var ids []string
+
+	if path == "" {
+		return nil, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	err = readLines(file, func(line int, text string, err error) {
+		if err != nil {
+			fmt.Printf("error (%s line %d): %s\n", path, line, err.Error())
+			return
+		}
+		if strings.HasPrefix(text, "#") {
+			return
+		}
+		ids = append(ids, text)
+	})
+	return ids, err
+}
+
+// revokeBodyLimit is the maximum size (in bytes) of a revoke request
+const revokeBodyLimit int64 = 1024
+
+type revokeRequest struct {
+	Id string `json:"id"`
+}
+
+// revocationId returns the id tokens are revoked by, the registered jti
+// claim is used; tokens without a jti are revoked by the custom id claim
+func revocationId(claims *Claims) string {
+	if claims.RegisteredClaims.ID != "" {
+		return claims.RegisteredClaims.ID
+	}
+	return claims.Id
+}
+
+// endpointRevoke revokes a token by its id, since revoking a token logs
+// its user out, the request must present the admin token (as a bearer
+// token in the authorization header)
+func endpointRevoke(store RevocationStore, adminToken string) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method != http.MethodPost {
+			writer.Header().Set("Allow", http.MethodPost)
+			response.WriteError(writer, http.StatusMethodNotAllowed, response.CodeMethodNotAllowed,
+				fmt.Errorf("method not allowed: %s", request.Method))
+			return
+		}
+		token := bearerToken(request.Header.Get(headerAuthorization))
+		if token == "" {
+			writer.Header().Set("WWW-Authenticate", schemeBearer)
+			response.WriteError(writer, http.StatusUnauthorized, response.CodeMissingToken, errMissingToken)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			response.WriteError(writer, http.StatusForbidden, response.CodeForbidden, errors.New("invalid admin token"))
+			return
+		}
+		var revoke revokeRequest
+		request.Body = http.MaxBytesReader(writer, request.Body, revokeBodyLimit)
+		if err := json.NewDecoder(request.Body).Decode(&revoke); err != nil {
+			var errMaxBytes *http.MaxBytesError
+			if errors.As(err, &errMaxBytes) {
+				response.WriteError(writer, http.StatusRequestEntityTooLarge, response.CodeBadRequest, err)
+				return
+			}
+			response.WriteError(writer, http.StatusBadRequest, response.CodeBadRequest, err)
+			return
+		}
+		if revoke.Id == "" {
+			response.WriteError(writer, http.StatusBadRequest, response.CodeBadRequest, errors.New("id is required"))
+			return
+		}
+		if err := store.Revoke(revoke.Id); err != nil {
+			response.WriteError(writer, http.StatusInternalServerError, response.CodeInternalError, err)
+			return
+		}
+		fmt.Printf("revoked: %s\n", revoke.Id)
+		writer.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,140 @@
+package rest_audit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/antonio-alexander/go-blog-context/internal/middleware"
+	"github.com/antonio-alexander/go-blog-context/internal/response"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestEndpointRevoke(t *testing.T) {
+	const adminToken string = "admin"
+
+	for _, c := range []struct {
+		name          string
+		authorization string
+		body          string
+		statusCode    int
+		revoked       bool
+	}{
+		{"anonymous", "", `{"id":"x"}`, http.StatusUnauthorized, false},
+		{"wrong_token", "Bearer nope", `{"id":"x"}`, http.StatusForbidden, false},
+		{"too_large", "Bearer " + adminToken, `{"id":"` + strings.Repeat("x", int(revokeBodyLimit)) + `"}`, http.StatusRequestEntityTooLarge, false},
+		{"missing_id", "Bearer " + adminToken, `{}`, http.StatusBadRequest, false},
+		{"revoked", "Bearer " + adminToken, `{"id":"x"}`, http.StatusNoContent, true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			store := newMemoryRevocationStore()
+			handler := middleware.ContentType(middleware.DefaultContentType)(
+				http.HandlerFunc(endpointRevoke(store, adminToken)))
+			request := httptest.NewRequest(http.MethodPost, "/revoke", strings.NewReader(c.body))
+			if c.authorization != "" {
+				request.Header.Set("Authorization", c.authorization)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			if recorder.Code != c.statusCode {
+				t.Fatalf("expected %d, got %d (%s)", c.statusCode, recorder.Code, recorder.Body)
+			}
+			if revoked, _ := store.IsRevoked("x"); revoked != c.revoked {
+				t.Fatalf("expected revoked to be %t", c.revoked)
+			}
+			if c.statusCode == http.StatusNoContent {
+				if contentType := recorder.Header().Get("Content-Type"); contentType != "" {
+					t.Fatalf("expected no content type, got %q", contentType)
+				}
+			}
+		})
+	}
+}
+
+func TestRevocationId(t *testing.T) {
+	claims := &Claims{Id: "id"}
+	if id := revocationId(claims); id != "id" {
+		t.Fatalf("expected id, got %q", id)
+	}
+	claims.RegisteredClaims = jwt.RegisteredClaims{ID: "jti"}
+	if id := revocationId(claims); id != "jti" {
+		t.Fatalf("expected jti, got %q", id)
+	}
+}
+
+func TestReadRevokedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "revoked")
+	content := "# comment\nid1\n\n" + strings.Repeat("x", maxLineSize+1) + "\n  id2  \nid3"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ids, err := readRevokedFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := []string{"id1", "id2", "id3"}; !reflect.DeepEqual(ids, expected) {
+		t.Fatalf("expected %v, got %v", expected, ids)
+	}
+}
+
+func TestRevokeMidSession(t *testing.T) {
+	const adminToken string = "admin"
+
+	revokedFile := filepath.Join(t.TempDir(), "revoked")
+	if err := os.WriteFile(revokedFile, []byte("seeded\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	signedToken := newTestToken(t, Claims{UserId: "user", Id: "id"})
+	var decoded response.Error
+	output := captureStdout(t, func() {
+		testServer := newTestServer(t, "-revoke_token", adminToken, "-revoked_file", revokedFile)
+		if authorized := getToken(t, testServer, signedToken); authorized.StatusCode != http.StatusOK {
+			t.Errorf("expected %d before revoking, got %d", http.StatusOK, authorized.StatusCode)
+		}
+		seeded := getToken(t, testServer, newTestToken(t, Claims{UserId: "user", Id: "seeded"}))
+		if seeded.StatusCode != http.StatusUnauthorized {
+			t.Errorf("expected the seeded id to be revoked, got %d", seeded.StatusCode)
+		}
+
+		request, err := http.NewRequest(http.MethodPost, testServer.URL+"/revoke", strings.NewReader(`{"id":"id"}`))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		request.Header.Set("Authorization", "Bearer "+adminToken)
+		revoke, err := testServer.Client().Do(request)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		revoke.Body.Close()
+		if revoke.StatusCode != http.StatusNoContent {
+			t.Errorf("expected %d, got %d", http.StatusNoContent, revoke.StatusCode)
+		}
+
+		//the same (still valid) token is rejected once it's revoked
+		revoked := getToken(t, testServer, signedToken)
+		if revoked.StatusCode != http.StatusUnauthorized {
+			t.Errorf("expected %d after revoking, got %d", http.StatusUnauthorized, revoked.StatusCode)
+		}
+		if err := json.NewDecoder(revoked.Body).Decode(&decoded); err != nil {
+			t.Error(err)
+		}
+	})
+	if decoded.Code != response.CodeTokenRevoked {
+		t.Fatalf("expected code %q, got %q", response.CodeTokenRevoked, decoded.Code)
+	}
+	var reasons []string
+	for _, event := range auditEvents(output) {
+		reasons = append(reasons, event.Reason)
+	}
+	if expected := []string{"", response.CodeTokenRevoked, response.CodeTokenRevoked}; !reflect.DeepEqual(reasons, expected) {
+		t.Fatalf("expected audit reasons %q, got %q: %s", expected, reasons, output)
+	}
+}
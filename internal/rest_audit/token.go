@@ -0,0 +1,144 @@
+package rest_audit
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/antonio-alexander/go-blog-context/internal/query"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	tokenSourceHeader string = "header"
+	tokenSourceCookie string = "cookie"
+	tokenSourceQuery  string = "query"
+	tokenSourceProxy  string = "proxy"
+)
+
+// the header names are canonicalized by http.Header.Get so any casing
+// (e.g., authorization) of the headers is read
+const (
+	headerAuthorization      string = "Authorization"
+	headerProxyAuthorization string = "Proxy-Authorization"
+)
+
+// errMissingToken is returned when none of the token sources have
+// a token
+var errMissingToken = errors.New("missing token")
+
+type tokenQuery struct {
+	Authorization string `query:"authorization"`
+}
+
+type tokenExtractor struct {
+	cookieName string
+	sources    []string
+}
+
+// newTokenExtractor creates an extractor for the sources (in order of
+// precedence), if the query is disallowed, the query source is ignored
+// since tokens in the url can leak (e.g., in logs or referrers)
+func newTokenExtractor(cookieName, sources string, disallowQuery bool) (*tokenExtractor, error) {
+	t := &tokenExtractor{cookieName: cookieName}
+	for _, source := range strings.Split(sources, ",") {
+		switch source = strings.TrimSpace(source); source {
+		default:
+			return nil, fmt.Errorf("unsupported token source: %s", source)
+		case tokenSourceQuery:
+			if !disallowQuery {
+				t.sources = append(t.sources, source)
+			}
+		case tokenSourceHeader, tokenSourceCookie, tokenSourceProxy:
+			t.sources = append(t.sources, source)
+		}
+	}
+	return t, nil
+}
+
+// schemeBearer is the authorization scheme advertised on 401s
+const schemeBearer string = "Bearer"
+
+// bearerToken removes the (case-insensitive) bearer scheme from the value
+// of an authorization header, values without the scheme are returned as
+// is (the raw token is also accepted)
+func bearerToken(value string) string {
+	if scheme, token, _ := strings.Cut(strings.TrimSpace(value), " "); strings.EqualFold(scheme, schemeBearer) {
+		return strings.TrimSpace(token)
+	}
+	return value
+}
+
+// extractToken will return the token from the first source (in order
+// of precedence) that has a non-empty token, errMissingToken is returned
+// if none of the sources have a token
+func (t *tokenExtractor) extractToken(request *http.Request) (string, error) {
+	for _, source := range t.sources {
+		switch source {
+		case tokenSourceHeader:
+			if token := bearerToken(request.Header.Get(headerAuthorization)); token != "" {
+				return token, nil
+			}
+		case tokenSourceProxy:
+			//some proxies use the proxy-authorization header (e.g., when
+			// the authorization header is used by the proxy itself)
+			if token := bearerToken(request.Header.Get(headerProxyAuthorization)); token != "" {
+				return token, nil
+			}
+		case tokenSourceCookie:
+			if cookie, err := request.Cookie(t.cookieName); err == nil && cookie.Value != "" {
+				return cookie.Value, nil
+			}
+		case tokenSourceQuery:
+			var params tokenQuery
+			if err := query.DecodeQuery(request, &params); err != nil {
+				return "", err
+			}
+			if params.Authorization != "" {
+				return params.Authorization, nil
+			}
+		}
+	}
+	return "", errMissingToken
+}
+
+const (
+	jwtAlgHMAC  string = "HS256"
+	jwtAlgEdDSA string = "EdDSA"
+)
+
+// newKeyFunc returns the function used to provide the key to verify a
+// token, it asserts the signing method of the token to prevent a token
+// signed with one algorithm from being verified with a key intended
+// for another
+func newKeyFunc(alg, jwtKey, publicKeyFile string) (jwt.Keyfunc, error) {
+	switch alg {
+	default:
+		return nil, fmt.Errorf("unsupported jwt algorithm: %s", alg)
+	case jwtAlgHMAC:
+		return func(token *jwt.Token) (interface{}, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("unexpected signing method: %s", token.Method.Alg())
+			}
+			return []byte(jwtKey), nil
+		}, nil
+	case jwtAlgEdDSA:
+		bytes, err := os.ReadFile(publicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		publicKey, err := jwt.ParseEdPublicKeyFromPEM(bytes)
+		if err != nil {
+			return nil, err
+		}
+		return func(token *jwt.Token) (interface{}, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodEd25519); !ok {
+				return nil, fmt.Errorf("unexpected signing method: %s", token.Method.Alg())
+			}
+			return publicKey, nil
+		}, nil
+	}
+}
@@ -0,0 +1,107 @@
+package rest_audit
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+type tokenCacheEntry struct {
+	key       [sha256.Size]byte
+	token     *jwt.Token
+	claims    Claims
+	expiresAt time.Time
+}
+
+// tokenCache is a least recently used cache of parsed (and validated)
+// tokens keyed by the hash of the token, entries never outlive the
+// token's expiration so expired tokens are never returned
+type tokenCache struct {
+	sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[[sha256.Size]byte]*list.Element
+	order   *list.List
+}
+
+func newTokenCache(size int, ttl time.Duration) *tokenCache {
+	return &tokenCache{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[[sha256.Size]byte]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// parseToken parses (and validates) the token, if the cache isn't nil,
+// tokens that have already been parsed are returned from the cache
+// (skipping signature verification)
+func parseToken(token string, parser *tokenParser, keyFunc jwt.Keyfunc, cache *tokenCache) (*jwt.Token, *Claims, error) {
+	if cache != nil {
+		if parsedToken, claims, ok := cache.get(token, time.Now()); ok {
+			return parsedToken, &claims, nil
+		}
+	}
+	claims := &Claims{}
+	parsedToken, err := parser.parse(token, claims, keyFunc)
+	if err == nil && cache != nil {
+		cache.set(token, parsedToken, *claims, time.Now())
+	}
+	return parsedToken, claims, err
+}
+
+// get returns the parsed token and a copy of its claims, false is
+// returned if the token isn't cached (or its entry has expired)
+func (c *tokenCache) get(token string, now time.Time) (*jwt.Token, Claims, bool) {
+	key := sha256.Sum256([]byte(token))
+	c.Lock()
+	defer c.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, Claims{}, false
+	}
+	entry := element.Value.(*tokenCacheEntry)
+	if !now.Before(entry.expiresAt) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return nil, Claims{}, false
+	}
+	c.order.MoveToFront(element)
+	return entry.token, entry.claims, true
+}
+
+// set caches the parsed token and its claims, the entry expires after
+// the ttl or when the token expires (whichever is first); if the cache
+// is full, the least recently used entry is evicted
+func (c *tokenCache) set(token string, parsedToken *jwt.Token, claims Claims, now time.Time) {
+	expiresAt := now.Add(c.ttl)
+	if claims.ExpiresAt != nil && claims.ExpiresAt.Time.Before(expiresAt) {
+		expiresAt = claims.ExpiresAt.Time
+	}
+	if !now.Before(expiresAt) {
+		return
+	}
+	key := sha256.Sum256([]byte(token))
+	c.Lock()
+	defer c.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.order.Remove(element)
+		delete(c.entries, key)
+	}
+	for c.order.Len() >= c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*tokenCacheEntry).key)
+	}
+	c.entries[key] = c.order.PushFront(&tokenCacheEntry{
+		key:       key,
+		token:     parsedToken,
+		claims:    claims,
+		expiresAt: expiresAt,
+	})
+}
@@ -0,0 +1,101 @@
+package rest_audit
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestParseTokenCached(t *testing.T) {
+	//the key func is only called when the token is parsed, so it's
+	// used to count cache misses
+	var parsed int
+	keyFunc := func(*jwt.Token) (interface{}, error) {
+		parsed++
+		return []byte(testJwtKey), nil
+	}
+	parser := newTokenParser(withAllowedAlgs(jwtAlgHMAC))
+	cache := newTokenCache(10, time.Minute)
+	signedToken := newTestToken(t, Claims{UserId: "user", Id: "id"})
+	for i := 0; i < 3; i++ {
+		_, claims, err := parseToken(signedToken, parser, keyFunc, cache)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if claims.UserId != "user" {
+			t.Fatalf("unexpected claims: %+v", claims)
+		}
+	}
+	if parsed != 1 {
+		t.Fatalf("expected the token to be parsed once, parsed %d times", parsed)
+	}
+	//invalid tokens aren't cached
+	keyFunc = func(*jwt.Token) (interface{}, error) {
+		parsed++
+		return nil, errors.New("invalid")
+	}
+	invalidToken := newTestToken(t, Claims{UserId: "other", Id: "id"})
+	for i := 0; i < 2; i++ {
+		if _, _, err := parseToken(invalidToken, parser, keyFunc, cache); err == nil {
+			t.Fatal("expected an error")
+		}
+	}
+	if parsed != 3 {
+		t.Fatalf("expected the invalid token to be parsed each time, parsed %d tokens", parsed)
+	}
+}
+
+func TestTokenCacheExpiry(t *testing.T) {
+	tNow := time.Now()
+	cache := newTokenCache(10, time.Minute)
+
+	//the entry expires when the token does (before the ttl)
+	claims := Claims{UserId: "user"}
+	claims.ExpiresAt = jwt.NewNumericDate(tNow.Add(10 * time.Second))
+	cache.set("token", nil, claims, tNow)
+	if _, _, ok := cache.get("token", tNow.Add(9*time.Second)); !ok {
+		t.Fatal("expected a cache hit")
+	}
+	if _, _, ok := cache.get("token", tNow.Add(10*time.Second)); ok {
+		t.Fatal("expected the expired entry not to be returned")
+	}
+	if cache.order.Len() != 0 || len(cache.entries) != 0 {
+		t.Fatal("expected the expired entry to be evicted")
+	}
+
+	//the entry expires after the ttl (before the token does)
+	claims.ExpiresAt = jwt.NewNumericDate(tNow.Add(time.Hour))
+	cache.set("token", nil, claims, tNow)
+	if _, _, ok := cache.get("token", tNow.Add(time.Minute)); ok {
+		t.Fatal("expected the entry to expire after the ttl")
+	}
+
+	//already expired tokens aren't cached
+	claims.ExpiresAt = jwt.NewNumericDate(tNow.Add(-time.Second))
+	cache.set("expired", nil, claims, tNow)
+	if len(cache.entries) != 0 {
+		t.Fatal("expected the expired token not to be cached")
+	}
+}
+
+func TestTokenCacheLRU(t *testing.T) {
+	tNow := time.Now()
+	cache := newTokenCache(2, time.Minute)
+	cache.set("a", nil, Claims{Id: "a"}, tNow)
+	cache.set("b", nil, Claims{Id: "b"}, tNow)
+	//a is used, so b is the least recently used entry
+	if _, _, ok := cache.get("a", tNow); !ok {
+		t.Fatal("expected a cache hit")
+	}
+	cache.set("c", nil, Claims{Id: "c"}, tNow)
+	if _, _, ok := cache.get("b", tNow); ok {
+		t.Fatal("expected b to be evicted")
+	}
+	for _, token := range []string{"a", "c"} {
+		if _, claims, ok := cache.get(token, tNow); !ok || claims.Id != token {
+			t.Fatalf("expected %s to be cached", token)
+		}
+	}
+}
@@ -0,0 +1,344 @@
+package rest_audit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/antonio-alexander/go-blog-context/internal/response"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestExtractTokenBearer(t *testing.T) {
+	extractor, err := newTokenExtractor("token", "header,proxy", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		name   string
+		header string
+		value  string
+		token  string
+	}{
+		{"raw", "Authorization", "abc.def.ghi", "abc.def.ghi"},
+		{"bearer", "Authorization", "Bearer abc.def.ghi", "abc.def.ghi"},
+		{"bearer_lowercase", "authorization", "bearer abc.def.ghi", "abc.def.ghi"},
+		{"bearer_uppercase", "AUTHORIZATION", "BEARER abc.def.ghi", "abc.def.ghi"},
+		{"proxy", "Proxy-Authorization", "abc.def.ghi", "abc.def.ghi"},
+		{"proxy_bearer", "proxy-authorization", "Bearer abc.def.ghi", "abc.def.ghi"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/token", nil)
+			request.Header.Set(c.header, c.value)
+			token, err := extractor.extractToken(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token != c.token {
+				t.Fatalf("expected %q, got %q", c.token, token)
+			}
+		})
+	}
+}
+
+func TestExtractTokenBearerWithoutToken(t *testing.T) {
+	extractor, err := newTokenExtractor("token", "header", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := httptest.NewRequest(http.MethodGet, "/token", nil)
+	request.Header.Set("Authorization", "Bearer")
+	if _, err := extractor.extractToken(request); !errors.Is(err, errMissingToken) {
+		t.Fatalf("expected %v, got %v", errMissingToken, err)
+	}
+}
+
+// newTokenRequest returns a request with the token in each of the
+// sources (the value of each token is its source)
+func newTokenRequest(sources ...string) *http.Request {
+	request := httptest.NewRequest(http.MethodGet, "/token", nil)
+	for _, source := range sources {
+		switch source {
+		case tokenSourceHeader:
+			request.Header.Set(headerAuthorization, source)
+		case tokenSourceProxy:
+			request.Header.Set(headerProxyAuthorization, source)
+		case tokenSourceCookie:
+			request.AddCookie(&http.Cookie{Name: "token", Value: source})
+		case tokenSourceQuery:
+			request.URL.RawQuery = "authorization=" + source
+		}
+	}
+	return request
+}
+
+func TestExtractTokenSources(t *testing.T) {
+	all := []string{tokenSourceHeader, tokenSourceCookie, tokenSourceQuery, tokenSourceProxy}
+
+	//each source independently, the other sources aren't read
+	for _, source := range all {
+		extractor, err := newTokenExtractor("token", source, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token, err := extractor.extractToken(newTokenRequest(all...)); err != nil || token != source {
+			t.Fatalf("%s: expected %q, got %q (%v)", source, source, token, err)
+		}
+		for _, other := range all {
+			if other == source {
+				continue
+			}
+			if _, err := extractor.extractToken(newTokenRequest(other)); !errors.Is(err, errMissingToken) {
+				t.Fatalf("%s: expected %s not to be read, got %v", source, other, err)
+			}
+		}
+	}
+
+	//the first source (in order of precedence) with a token wins
+	for sources, expected := range map[string]string{
+		"header,cookie,query": tokenSourceHeader,
+		"cookie,header,query": tokenSourceCookie,
+		"query,cookie,header": tokenSourceQuery,
+		"proxy,header":        tokenSourceProxy,
+	} {
+		extractor, err := newTokenExtractor("token", sources, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token, _ := extractor.extractToken(newTokenRequest(all...)); token != expected {
+			t.Fatalf("%s: expected %q, got %q", sources, expected, token)
+		}
+		//sources without a token are skipped
+		if token, _ := extractor.extractToken(newTokenRequest(tokenSourceHeader)); token != tokenSourceHeader {
+			t.Fatalf("%s: expected %q, got %q", sources, tokenSourceHeader, token)
+		}
+	}
+	if _, err := newTokenExtractor("token", "header,unknown", false); err == nil {
+		t.Fatal("expected an error for an unsupported source")
+	}
+}
+
+func TestKeyFuncEdDSA(t *testing.T) {
+	bytes, err := os.ReadFile("testdata/ed25519_private.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, err := jwt.ParseEdPrivateKeyFromPEM(bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFunc, err := newKeyFunc(jwtAlgEdDSA, "", "testdata/ed25519_public.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := newTestTokenConfig(t)
+	cfg.keyFunc, cfg.parser = keyFunc, newTokenParser(withAllowedAlgs(jwtAlgEdDSA))
+
+	claims := Claims{UserId: "user", Id: "id"}
+	claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Minute))
+	signedToken, err := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims).SignedString(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorder := serveToken(cfg, signedToken); recorder.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, recorder.Code)
+	}
+	//a token signed with hmac is rejected when configured for EdDSA
+	if recorder := serveToken(cfg, newTestToken(t, claims)); recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("expected %d, got %d", http.StatusUnauthorized, recorder.Code)
+	}
+	//even if the parser allowed it, the key func asserts the method
+	if _, err := keyFunc(jwt.New(jwt.SigningMethodHS256)); err == nil {
+		t.Fatal("expected the hmac signing method to be rejected")
+	}
+
+	if _, err := newKeyFunc(jwtAlgEdDSA, "", "testdata/missing.pem"); err == nil {
+		t.Fatal("expected an error for a missing public key")
+	}
+}
+
+func TestEndpointTokenMissing(t *testing.T) {
+	//no token (or an empty bearer token) is rejected before parsing
+	for name, authorization := range map[string]string{
+		"none":         "",
+		"empty_bearer": "Bearer ",
+	} {
+		request := httptest.NewRequest(http.MethodGet, "/token", nil)
+		if authorization != "" {
+			request.Header.Set("Authorization", authorization)
+		}
+		recorder := httptest.NewRecorder()
+		endpointToken(newTestTokenConfig(t))(recorder, request)
+		if recorder.Code != http.StatusUnauthorized {
+			t.Fatalf("%s: expected %d, got %d", name, http.StatusUnauthorized, recorder.Code)
+		}
+		if challenge := recorder.Header().Get("WWW-Authenticate"); challenge != schemeBearer {
+			t.Fatalf("%s: expected the challenge %q, got %q", name, schemeBearer, challenge)
+		}
+		var e response.Error
+		if err := json.NewDecoder(recorder.Body).Decode(&e); err != nil || e.Code != response.CodeMissingToken {
+			t.Fatalf("%s: expected code %q, got %+v (%v)", name, response.CodeMissingToken, e, err)
+		}
+	}
+}
+
+func TestLogTokenHeader(t *testing.T) {
+	signedToken := newTestTokenWithHeader(t, Claims{UserId: "secret-user", Id: "secret-id"}, map[string]any{"kid": "kid"})
+	cfg := newTestTokenConfig(t)
+	cfg.logHeader = true
+	output := captureStdout(t, func() {
+		if recorder := serveToken(cfg, signedToken); recorder.Code != http.StatusOK {
+			t.Errorf("expected %d, got %d", http.StatusOK, recorder.Code)
+		}
+	})
+	if !strings.Contains(output, "jwt header: alg=HS256, typ=JWT, kid=kid") {
+		t.Fatalf("expected the header fields to be logged: %s", output)
+	}
+	//neither the token (or any of its segments) nor the claims are logged
+	for _, secret := range append(strings.Split(signedToken, "."), "secret-user", "secret-id") {
+		if strings.Contains(output, secret) {
+			t.Fatalf("expected %q not to be logged: %s", secret, output)
+		}
+	}
+}
+
+func TestClassifyJWTError(t *testing.T) {
+	claims := Claims{UserId: "user", Id: "id"}
+	expired := claims
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+	notYetValid := claims
+	notYetValid.NotBefore = jwt.NewNumericDate(time.Now().Add(time.Hour))
+	wrongKey, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("wrong"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		name   string
+		token  string
+		status int
+		code   string
+	}{
+		{"expired", newTestToken(t, expired), http.StatusUnauthorized, response.CodeTokenExpired},
+		{"not_yet_valid", newTestToken(t, notYetValid), http.StatusUnauthorized, response.CodeTokenNotValidYet},
+		{"signature_invalid", wrongKey, http.StatusUnauthorized, response.CodeInvalidSignature},
+		{"malformed", "abc.def", http.StatusBadRequest, response.CodeMalformedToken},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			recorder := serveToken(newTestTokenConfig(t), c.token)
+			var e response.Error
+			if err := json.NewDecoder(recorder.Body).Decode(&e); err != nil {
+				t.Fatal(err)
+			}
+			if recorder.Code != c.status || e.Code != c.code {
+				t.Fatalf("expected %d %q, got %d %q", c.status, c.code, recorder.Code, e.Code)
+			}
+		})
+	}
+
+	//the sentinels are matched even if they're wrapped
+	for sentinel, code := range map[error]string{
+		jwt.ErrTokenExpired:          response.CodeTokenExpired,
+		jwt.ErrTokenNotValidYet:      response.CodeTokenNotValidYet,
+		jwt.ErrTokenSignatureInvalid: response.CodeInvalidSignature,
+		jwt.ErrTokenMalformed:        response.CodeMalformedToken,
+	} {
+		if _, classified := classifyJWTError(fmt.Errorf("wrapped: %w", sentinel)); classified != code {
+			t.Fatalf("%v: expected %q, got %q", sentinel, code, classified)
+		}
+	}
+	if status, _ := classifyJWTError(errors.New("unknown")); status != http.StatusInternalServerError {
+		t.Fatalf("expected %d, got %d", http.StatusInternalServerError, status)
+	}
+}
+
+func TestExtractTokenHeaderCase(t *testing.T) {
+	//the header names are sent as is (rather than canonicalized by the
+	// client), the server must read them regardless of their case
+	extractor, err := newTokenExtractor("token", "header,proxy", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := make(chan string, 1)
+	testServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		token, _ := extractor.extractToken(request)
+		tokens <- token
+	}))
+	defer testServer.Close()
+	for _, header := range []string{
+		"Authorization", "authorization", "AUTHORIZATION",
+		"Proxy-Authorization", "proxy-authorization", "PROXY-AUTHORIZATION",
+	} {
+		conn, err := net.Dial("tcp", testServer.Listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = fmt.Fprintf(conn, "GET /token HTTP/1.1\r\nHost: localhost\r\n%s: Bearer abc.def.ghi\r\nConnection: close\r\n\r\n", header)
+		if err != nil {
+			conn.Close()
+			t.Fatal(err)
+		}
+		_, _ = io.Copy(io.Discard, conn)
+		conn.Close()
+		if token := <-tokens; token != "abc.def.ghi" {
+			t.Fatalf("%s: expected %q, got %q", header, "abc.def.ghi", token)
+		}
+	}
+
+	//the proxy header is a fallback, it's only read if the authorization
+	// header is missing
+	if token, _ := extractor.extractToken(newTokenRequest(tokenSourceHeader, tokenSourceProxy)); token != tokenSourceHeader {
+		t.Fatalf("expected %q, got %q", tokenSourceHeader, token)
+	}
+	if token, _ := extractor.extractToken(newTokenRequest(tokenSourceProxy)); token != tokenSourceProxy {
+		t.Fatalf("expected %q, got %q", tokenSourceProxy, token)
+	}
+}
+
+func TestDisallowQueryToken(t *testing.T) {
+	extractor, err := newTokenExtractor("token", "header,cookie,query", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := extractor.extractToken(newTokenRequest(tokenSourceQuery)); !errors.Is(err, errMissingToken) {
+		t.Fatalf("expected %v, got %v", errMissingToken, err)
+	}
+	if token, err := extractor.extractToken(newTokenRequest(tokenSourceHeader)); err != nil || token != tokenSourceHeader {
+		t.Fatalf("expected %q, got %q (%v)", tokenSourceHeader, token, err)
+	}
+
+	//a valid token in the query is only accepted if it's allowed
+	token := newTestToken(t, Claims{UserId: "user", Id: "id"})
+	for name, c := range map[string]struct {
+		args   []string
+		status int
+	}{
+		"allowed":    {status: http.StatusOK},
+		"disallowed": {args: []string{"-disallow_query_token"}, status: http.StatusUnauthorized},
+	} {
+		testServer := newTestServer(t, c.args...)
+		resp, err := testServer.Client().Get(testServer.URL + "/token?authorization=" + token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != c.status {
+			t.Fatalf("%s: expected %d, got %d", name, c.status, resp.StatusCode)
+		}
+		if c.status == http.StatusOK {
+			continue
+		}
+		var e response.Error
+		if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || e.Code != response.CodeMissingToken {
+			t.Fatalf("%s: expected code %q, got %+v (%v)", name, response.CodeMissingToken, e, err)
+		}
+	}
+}
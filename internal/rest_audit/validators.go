@@ -0,0 +1,17 @@
+package rest_audit
+
+// ClaimsValidator validates (custom) claims, it's executed after the
+// signature and standard claims have been validated; a non-nil error
+// rejects the token
+type ClaimsValidator func(Claims) error
+
+// validateClaims executes the validators (in order) and returns the
+// first error
+func validateClaims(claims Claims, validators []ClaimsValidator) error {
+	for _, validator := range validators {
+		if err := validator(claims); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package rest_audit
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestClaimsValidators(t *testing.T) {
+	var executed []string
+
+	cfg := newTestTokenConfig(t)
+	cfg.claimsValidators = []ClaimsValidator{
+		func(Claims) error {
+			executed = append(executed, "first")
+			return nil
+		},
+		func(claims Claims) error {
+			executed = append(executed, "second")
+			if claims.Tenant != "tenant" {
+				return errors.New("unexpected tenant")
+			}
+			return nil
+		},
+	}
+	recorder := serveToken(cfg, newTestToken(t, Claims{Id: "id", UserId: "user", Tenant: "other"}))
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("expected %d, got %d", http.StatusForbidden, recorder.Code)
+	}
+	if len(executed) != 2 || executed[0] != "first" || executed[1] != "second" {
+		t.Fatalf("expected the validators to execute in order, got %v", executed)
+	}
+	recorder = serveToken(cfg, newTestToken(t, Claims{Id: "id", UserId: "user", Tenant: "tenant"}))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, recorder.Code)
+	}
+}
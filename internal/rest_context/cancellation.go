@@ -0,0 +1,86 @@
+package rest_context
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/antonio-alexander/go-blog-context/internal/response"
+)
+
+// statusClientClosedRequest is the (non-standard) status used when
+// the client closed the request before a response was written
+const statusClientClosedRequest int = 499
+
+const (
+	reasonCanceled         string = "canceled"
+	reasonDeadlineExceeded string = "deadline_exceeded"
+	reasonUnknown          string = "unknown"
+)
+
+// errServerShutdown is the cause used to cancel the base context
+// of the server when it's shutting down
+var errServerShutdown = errors.New("server shutting down")
+
+// cancellationReason classifies why the context is done, if the context
+// was cancelled with a cause (other than the error itself) the cause is
+// appended to the reason; an empty string is returned if the context
+// isn't done
+func cancellationReason(ctx context.Context) string {
+	err := ctx.Err()
+	if err == nil {
+		return ""
+	}
+	reason := reasonUnknown
+	switch {
+	case errors.Is(err, context.Canceled):
+		reason = reasonCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		reason = reasonDeadlineExceeded
+	}
+	if cause := context.Cause(ctx); cause != nil && cause != err {
+		return reason + ": " + cause.Error()
+	}
+	return reason
+}
+
+// cancellationStatus maps why the context is done to a status code: the
+// server shutting down is a 503, a deadline is a 504 and anything else is
+// treated as the client closing the request (499)
+func cancellationStatus(ctx context.Context) int {
+	switch {
+	case errors.Is(context.Cause(ctx), errServerShutdown):
+		return http.StatusServiceUnavailable
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	default:
+		return statusClientClosedRequest
+	}
+}
+
+// wastedWork describes the work done after the context was cancelled, only
+// a cancellation without a server side cause (e.g. the max request duration
+// or shutdown) is reported as the client disconnecting
+func wastedWork(ctx context.Context, id string, tStart, tCancelled time.Time) string {
+	if cancellationStatus(ctx) == statusClientClosedRequest {
+		return fmt.Sprintf("%s client disconnected %v into the request, wasted work: %v",
+			id, tCancelled.Sub(tStart), time.Since(tCancelled))
+	}
+	return fmt.Sprintf("%s request cancelled (%s) %v into the request, wasted work: %v",
+		id, cancellationReason(ctx), tCancelled.Sub(tStart), time.Since(tCancelled))
+}
+
+// writeCancellation writes the status (and reason) of a cancelled request,
+// if the client closed the request, no body is written since it's gone
+func writeCancellation(writer http.ResponseWriter, ctx context.Context) {
+	switch statusCode := cancellationStatus(ctx); statusCode {
+	default:
+		writer.WriteHeader(statusCode)
+	case http.StatusServiceUnavailable:
+		response.WriteError(writer, statusCode, response.CodeShuttingDown, errors.New(cancellationReason(ctx)))
+	case http.StatusGatewayTimeout:
+		response.WriteError(writer, statusCode, response.CodeTimeout, errors.New(cancellationReason(ctx)))
+	}
+}
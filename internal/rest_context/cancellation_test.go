@@ -0,0 +1,115 @@
+package rest_context
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/antonio-alexander/go-blog-context/internal/response"
+)
+
+func TestWastedWork(t *testing.T) {
+	//the max request duration (http.TimeoutHandler) cancels the request
+	// context, this shouldn't be reported as the client disconnecting
+	var message string
+	done := make(chan struct{})
+	handler := http.TimeoutHandler(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		tStart := time.Now()
+		<-request.Context().Done()
+		message = wastedWork(request.Context(), "id", tStart, time.Now())
+		close(done)
+	}), 10*time.Millisecond, "")
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	<-done
+	if strings.Contains(message, "client disconnected") {
+		t.Fatalf("expected a timeout, got %q", message)
+	}
+	if !strings.Contains(message, reasonDeadlineExceeded) {
+		t.Fatalf("expected %q in %q", reasonDeadlineExceeded, message)
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(errServerShutdown)
+	if message := wastedWork(ctx, "id", time.Now(), time.Now()); strings.Contains(message, "client disconnected") {
+		t.Fatalf("expected a shutdown, got %q", message)
+	}
+
+	ctx, cancel2 := context.WithCancel(context.Background())
+	cancel2()
+	if message := wastedWork(ctx, "id", time.Now(), time.Now()); !strings.Contains(message, "client disconnected") {
+		t.Fatalf("expected a client disconnect, got %q", message)
+	}
+}
+
+func TestCancellationReason(t *testing.T) {
+	if reason := cancellationReason(context.Background()); reason != "" {
+		t.Fatalf("expected no reason, got %q", reason)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if reason := cancellationReason(ctx); reason != reasonCanceled {
+		t.Fatalf("expected %q, got %q", reasonCanceled, reason)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	if reason := cancellationReason(ctx); reason != reasonDeadlineExceeded {
+		t.Fatalf("expected %q, got %q", reasonDeadlineExceeded, reason)
+	}
+
+	//a custom cause is appended to the reason
+	ctxCause, cancelCause := context.WithCancelCause(context.Background())
+	cancelCause(errors.New("custom cause"))
+	if reason := cancellationReason(ctxCause); reason != reasonCanceled+": custom cause" {
+		t.Fatalf("expected %q, got %q", reasonCanceled+": custom cause", reason)
+	}
+	ctxCause, cancelCause = context.WithCancelCause(context.Background())
+	cancelCause(errServerShutdown)
+	if reason := cancellationReason(ctxCause); reason != reasonCanceled+": "+errServerShutdown.Error() {
+		t.Fatalf("expected the shutdown cause, got %q", reason)
+	}
+}
+
+func TestCancellationStatus(t *testing.T) {
+	ctxShutdown, cancelShutdown := context.WithCancelCause(context.Background())
+	cancelShutdown(errServerShutdown)
+	ctxDeadline, cancelDeadline := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancelDeadline()
+	<-ctxDeadline.Done()
+	ctxCancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	for name, c := range map[string]struct {
+		ctx    context.Context
+		status int
+		code   string
+	}{
+		"shutdown":  {ctxShutdown, http.StatusServiceUnavailable, response.CodeShuttingDown},
+		"deadline":  {ctxDeadline, http.StatusGatewayTimeout, response.CodeTimeout},
+		"cancelled": {ctxCancelled, statusClientClosedRequest, ""},
+	} {
+		if status := cancellationStatus(c.ctx); status != c.status {
+			t.Fatalf("%s: expected %d, got %d", name, c.status, status)
+		}
+		recorder := httptest.NewRecorder()
+		writeCancellation(recorder, c.ctx)
+		if recorder.Code != c.status {
+			t.Fatalf("%s: expected %d, got %d", name, c.status, recorder.Code)
+		}
+		//the client is gone, so no body is written
+		if c.code == "" {
+			if recorder.Body.Len() != 0 {
+				t.Fatalf("%s: expected no body, got %q", name, recorder.Body)
+			}
+			continue
+		}
+		if e := decodeError(t, recorder); e.Code != c.code {
+			t.Fatalf("%s: expected code %q, got %q", name, c.code, e.Code)
+		}
+	}
+}
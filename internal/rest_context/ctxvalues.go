@@ -0,0 +1,78 @@
+package rest_context
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/antonio-alexander/go-blog-context/internal/response"
+)
+
+// the string keys below are intentionally bare strings to show what
+// happens when two packages (or layers) each declare their own key but
+// happen to use the same string
+const (
+	keyStringUserA string = "user"
+	keyStringUserB string = "user"
+)
+
+// typed keys are unique by type (not value), even if two packages
+// used an empty struct, the types (and therefore keys) would differ
+type (
+	keyTypedUserA struct{}
+	keyTypedUserB struct{}
+)
+
+type ctxValues struct {
+	LayerA    string `json:"layer_a"`
+	LayerB    string `json:"layer_b"`
+	Collision bool   `json:"collision"`
+}
+
+type ctxValuesResponse struct {
+	StringKeys ctxValues `json:"string_keys"`
+	TypedKeys  ctxValues `json:"typed_keys"`
+}
+
+func layerAValues(ctx context.Context) ctxValuesResponse {
+	//lint:ignore SA1029 intentionally using a bare string key
+	ctx = context.WithValue(ctx, keyStringUserA, "layer_a")
+	ctx = context.WithValue(ctx, keyTypedUserA{}, "layer_a")
+	return layerBValues(ctx)
+}
+
+func layerBValues(ctx context.Context) ctxValuesResponse {
+	//lint:ignore SA1029 intentionally using a bare string key
+	ctx = context.WithValue(ctx, keyStringUserB, "layer_b")
+	ctx = context.WithValue(ctx, keyTypedUserB{}, "layer_b")
+
+	//with string keys, layer b has overwritten (shadowed) the value
+	// stored by layer a even though they used different keys; there's
+	// no way for layer a to get its value
+	stringA, _ := ctx.Value(keyStringUserA).(string)
+	stringB, _ := ctx.Value(keyStringUserB).(string)
+	typedA, _ := ctx.Value(keyTypedUserA{}).(string)
+	typedB, _ := ctx.Value(keyTypedUserB{}).(string)
+	return ctxValuesResponse{
+		StringKeys: ctxValues{
+			LayerA:    stringA,
+			LayerB:    stringB,
+			Collision: stringA != "layer_a",
+		},
+		TypedKeys: ctxValues{
+			LayerA:    typedA,
+			LayerB:    typedB,
+			Collision: typedA != "layer_a",
+		},
+	}
+}
+
+func endpointCtxValues(log io.Writer) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		values := layerAValues(request.Context())
+		if err := response.NewEncoder(writer, request).Encode(values); err != nil {
+			fmt.Fprintf(log, "error: %s\n", err.Error())
+		}
+	}
+}
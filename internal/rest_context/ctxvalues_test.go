@@ -0,0 +1,16 @@
+package rest_context
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCtxValues(t *testing.T) {
+	values := layerAValues(context.Background())
+	if values.StringKeys.LayerA != "layer_b" || !values.StringKeys.Collision {
+		t.Fatalf("expected the string key of layer a to be shadowed by layer b, got %+v", values.StringKeys)
+	}
+	if values.TypedKeys.LayerA != "layer_a" || values.TypedKeys.LayerB != "layer_b" || values.TypedKeys.Collision {
+		t.Fatalf("expected the typed keys not to collide, got %+v", values.TypedKeys)
+	}
+}
@@ -0,0 +1,55 @@
+package rest_context
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/antonio-alexander/go-blog-context/internal/ctxkeys"
+	"github.com/antonio-alexander/go-blog-context/internal/middleware"
+	"github.com/antonio-alexander/go-blog-context/internal/response"
+
+	_ "github.com/lib/pq"
+)
+
+const dbDriver string = "postgres"
+
+// endpointDB runs a slow query (pg_sleep) for the requested timeout using
+// the request context, when the request is cancelled (e.g., the client
+// disconnects) the driver cancels the query on the database
+func endpointDB(log io.Writer, db *sql.DB, guard writeTimeoutGuard) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", middleware.ContentTypeText)
+		id := ctxkeys.RequestId(request.Context())
+		tNow := time.Now()
+		timeout, source, err := ResolveTimeout(request)
+		if err != nil {
+			fmt.Fprintf(log, "error (%s): %s\n", id, err.Error())
+			response.WriteError(writer, http.StatusBadRequest, response.CodeBadRequest, err)
+			return
+		}
+		fmt.Fprintf(log, "%s db timeout: %v (%s)\n", id, timeout, source)
+		writer.Header().Set(headerTimeoutSource, string(source))
+		if err := guard.check(log, id, timeout); err != nil {
+			response.WriteError(writer, http.StatusBadRequest, response.CodeBadRequest, err)
+			return
+		}
+		if _, err := db.ExecContext(request.Context(), "SELECT pg_sleep($1)", timeout.Seconds()); err != nil {
+			if request.Context().Err() != nil {
+				reason := cancellationReason(request.Context())
+				fmt.Fprintf(log, "%s db query cancelled via ctx (%s, %s): %v\n", id, reason, ctxkeys.Proto(request.Context()), time.Since(tNow))
+				writeCancellation(writer, request.Context())
+				return
+			}
+			fmt.Fprintf(log, "error (%s): %s\n", id, err.Error())
+			response.WriteError(writer, http.StatusInternalServerError, response.CodeInternalError, err)
+			return
+		}
+		fmt.Fprintf(log, "%s db query completed\n", id)
+		if _, err := fmt.Fprintf(writer, "%s: %v\n", id, time.Since(tNow)); err != nil {
+			fmt.Fprintf(log, "error (%s): %s", id, err.Error())
+		}
+	}
+}
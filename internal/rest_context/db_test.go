@@ -0,0 +1,82 @@
+package rest_context
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// slowConn is a fake database connection (and connector), each statement
+// sleeps for the duration of its argument (in seconds) unless its context
+// is done
+type slowConn struct {
+	cancelled chan error
+}
+
+func (c *slowConn) Connect(context.Context) (driver.Conn, error) { return c, nil }
+func (c *slowConn) Driver() driver.Driver                        { return nil }
+func (c *slowConn) Prepare(string) (driver.Stmt, error)          { return nil, errors.New("not supported") }
+func (c *slowConn) Close() error                                 { return nil }
+func (c *slowConn) Begin() (driver.Tx, error)                    { return nil, errors.New("not supported") }
+
+func (c *slowConn) ExecContext(ctx context.Context, _ string, args []driver.NamedValue) (driver.Result, error) {
+	seconds, _ := args[0].Value.(float64)
+	select {
+	case <-time.After(time.Duration(seconds * float64(time.Second))):
+		return driver.ResultNoRows, nil
+	case <-ctx.Done():
+		c.cancelled <- ctx.Err()
+		return nil, ctx.Err()
+	}
+}
+
+func TestEndpointDBCancelled(t *testing.T) {
+	conn := &slowConn{cancelled: make(chan error, 1)}
+	db := sql.OpenDB(conn)
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	request := httptest.NewRequest(http.MethodGet, "/db?timeout=1m", nil).WithContext(ctx)
+	recorder := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		endpointDB(io.Discard, db, writeTimeoutGuard{})(recorder, request)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-conn.cancelled:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected %v, got %v", context.Canceled, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the query to be aborted")
+	}
+	<-done
+	if recorder.Code != statusClientClosedRequest {
+		t.Fatalf("expected %d, got %d", statusClientClosedRequest, recorder.Code)
+	}
+
+	//the query completes if the request isn't cancelled
+	recorder = httptest.NewRecorder()
+	endpointDB(io.Discard, db, writeTimeoutGuard{})(recorder, httptest.NewRequest(http.MethodGet, "/db?timeout=10ms", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, recorder.Code)
+	}
+}
+
+func TestEndpointDBDisabled(t *testing.T) {
+	//without a dsn the route is a 404 (rather than the non ctx endpoint)
+	testServer := newTestServer(t)
+	if response := get(t, testServer, "/db?timeout=1"); response.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected %d, got %d", http.StatusNotFound, response.StatusCode)
+	}
+}
@@ -0,0 +1,158 @@
+package rest_context
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/antonio-alexander/go-blog-context/internal/ctxkeys"
+	"github.com/antonio-alexander/go-blog-context/internal/query"
+	"github.com/antonio-alexander/go-blog-context/internal/response"
+)
+
+const (
+	eventProgress  string = "progress"
+	eventDone      string = "done"
+	eventCancelled string = "cancelled"
+	eventShutdown  string = "shutdown"
+)
+
+type eventsQuery struct {
+	Duration time.Duration `query:"duration"`
+}
+
+// streamTracker is used to signal active streams when the server is
+// shutting down and to wait for them to close, streams can't be started
+// once the tracker has been stopped
+type streamTracker struct {
+	mutex   sync.Mutex
+	wg      sync.WaitGroup
+	stop    chan struct{}
+	stopped bool
+}
+
+func newStreamTracker() *streamTracker {
+	return &streamTracker{stop: make(chan struct{})}
+}
+
+// start registers a stream, it returns a channel that's closed when
+// the stream should stop, false is returned if the tracker is stopped
+func (s *streamTracker) start() (<-chan struct{}, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.stopped {
+		return nil, false
+	}
+	s.wg.Add(1)
+	return s.stop, true
+}
+
+func (s *streamTracker) done() {
+	s.wg.Done()
+}
+
+// stopAndWait signals all active streams to stop and blocks until
+// they've closed
+func (s *streamTracker) stopAndWait() {
+	s.mutex.Lock()
+	if !s.stopped {
+		s.stopped = true
+		close(s.stop)
+	}
+	s.mutex.Unlock()
+	s.wg.Wait()
+}
+
+func writeEvent(writer http.ResponseWriter, flusher http.Flusher, event, data string) error {
+	if _, err := fmt.Fprintf(writer, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	flusher.Flush()
+	return nil
+}
+
+// endpointEvents emits a progress (server-sent) event every second until
+// the duration elapses; if the request context is done, a final cancelled
+// event is sent (if the client is still listening) and the stream ends;
+// if the server is shutting down, a final shutdown event is sent. If an
+// event can't be written, the client is treated as disconnected. Durations
+// that exceed the maximum (if greater than zero) are rejected
+func endpointEvents(log io.Writer, guard writeTimeoutGuard, streams *streamTracker, maxDuration time.Duration) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		id := ctxkeys.RequestId(request.Context())
+		tNow, params := time.Now(), eventsQuery{Duration: 10 * time.Second}
+		if err := query.DecodeQuery(request, &params); err != nil {
+			response.WriteError(writer, http.StatusBadRequest, response.CodeBadRequest, err)
+			return
+		}
+		duration := params.Duration
+		if maxDuration > 0 && duration > maxDuration {
+			response.WriteError(writer, http.StatusBadRequest, response.CodeBadRequest,
+				fmt.Errorf("duration (%v) exceeds the maximum stream duration (%v)", duration, maxDuration))
+			return
+		}
+		if err := guard.check(log, id, duration); err != nil {
+			response.WriteError(writer, http.StatusBadRequest, response.CodeBadRequest, err)
+			return
+		}
+		flusher, ok := writer.(http.Flusher)
+		if !ok {
+			response.WriteError(writer, http.StatusInternalServerError, response.CodeInternalError,
+				errors.New("streaming not supported"))
+			return
+		}
+		stop, ok := streams.start()
+		if !ok {
+			response.WriteError(writer, http.StatusServiceUnavailable, response.CodeShuttingDown, errServerShutdown)
+			return
+		}
+		defer streams.done()
+		writer.Header().Set("Content-Type", "text/event-stream")
+		writer.Header().Set("Cache-Control", "no-cache")
+		writer.Header().Set("Connection", "keep-alive")
+		writer.WriteHeader(http.StatusOK)
+		flusher.Flush()
+		fmt.Fprintf(log, "%s events: %v\n", id, duration)
+		tProgress := time.NewTicker(time.Second)
+		defer tProgress.Stop()
+		tDone := time.NewTimer(duration)
+		defer tDone.Stop()
+		for {
+			select {
+			case <-stop:
+				fmt.Fprintf(log, "%s events stopped (shutdown): %v\n", id, time.Since(tNow))
+				if err := writeEvent(writer, flusher, eventShutdown, errServerShutdown.Error()); err != nil {
+					fmt.Fprintf(log, "error (%s): %s\n", id, err.Error())
+				}
+				return
+			case <-request.Context().Done():
+				reason := cancellationReason(request.Context())
+				fmt.Fprintf(log, "%s events cancelled via ctx (%s, %s): %v\n", id, reason, ctxkeys.Proto(request.Context()), time.Since(tNow))
+				if err := writeEvent(writer, flusher, eventCancelled, reason); err != nil {
+					fmt.Fprintf(log, "error (%s): %s\n", id, err.Error())
+				}
+				return
+			case <-tDone.C:
+				fmt.Fprintf(log, "%s events completed\n", id)
+				if err := writeEvent(writer, flusher, eventDone, time.Since(tNow).String()); err != nil {
+					fmt.Fprintf(log, "error (%s): %s\n", id, err.Error())
+				}
+				return
+			case <-tProgress.C:
+				elapsed := time.Since(tNow)
+				if err := writeEvent(writer, flusher, eventProgress,
+					fmt.Sprintf(`{"elapsed_ms":%d,"duration_ms":%d}`, elapsed.Milliseconds(), duration.Milliseconds())); err != nil {
+					//a failed write means the client is gone (even if the
+					// context hasn't been cancelled yet), so stop streaming
+					fmt.Fprintf(log, "%s events stopped, client disconnected (write failed: %s): %v\n",
+						id, err.Error(), time.Since(tNow))
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package rest_context
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/antonio-alexander/go-blog-context/internal/response"
+)
+
+// serveEvents serves a request to the events endpoint (in the background)
+// and returns the recorder and a channel closed once the handler returns
+func serveEvents(ctx context.Context, streams *streamTracker, target string) (*httptest.ResponseRecorder, <-chan struct{}) {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, target, nil).WithContext(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		endpointEvents(io.Discard, writeTimeoutGuard{}, streams, time.Hour)(recorder, request)
+	}()
+	return recorder, done
+}
+
+func TestEventsCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	recorder, done := serveEvents(ctx, newStreamTracker(), "/events?duration=1m")
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected cancellation to stop the stream")
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "text/event-stream" {
+		t.Fatalf("expected %q, got %q", "text/event-stream", contentType)
+	}
+	if !recorder.Flushed {
+		t.Fatal("expected the stream to be flushed")
+	}
+	if body := recorder.Body.String(); !strings.HasSuffix(body, "event: "+eventCancelled+"\ndata: "+reasonCanceled+"\n\n") {
+		t.Fatalf("expected a final cancelled event, got %q", body)
+	}
+}
+
+func TestEventsShutdown(t *testing.T) {
+	streams := newStreamTracker()
+	recorder, done := serveEvents(context.Background(), streams, "/events?duration=1m")
+	time.Sleep(10 * time.Millisecond)
+	streams.stopAndWait()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected the shutdown to stop the stream")
+	}
+	if body := recorder.Body.String(); !strings.Contains(body, "event: "+eventShutdown+"\n") {
+		t.Fatalf("expected a final shutdown event, got %q", body)
+	}
+	//streams can't be started once the tracker is stopped
+	recorder, done = serveEvents(context.Background(), streams, "/events?duration=1m")
+	<-done
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected %d, got %d", http.StatusServiceUnavailable, recorder.Code)
+	}
+}
+
+func TestEventsDone(t *testing.T) {
+	recorder, done := serveEvents(context.Background(), newStreamTracker(), "/events?duration=10ms")
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected the stream to complete")
+	}
+	if body := recorder.Body.String(); !strings.Contains(body, "event: "+eventDone+"\n") {
+		t.Fatalf("expected a final done event, got %q", body)
+	}
+}
+
+// failingWriter fails every write as if the client disconnected (without
+// the request context being cancelled)
+type failingWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestEventsWriteFailed(t *testing.T) {
+	//a failed write is treated as the client disconnecting and stops
+	// the stream (long before its duration)
+	done, output := make(chan struct{}), &syncBuffer{}
+	go func() {
+		defer close(done)
+		writer := failingWriter{httptest.NewRecorder()}
+		endpointEvents(output, writeTimeoutGuard{}, newStreamTracker(), time.Hour)(writer,
+			httptest.NewRequest(http.MethodGet, "/events?duration=1m", nil))
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the failed write to stop the stream")
+	}
+	if !strings.Contains(output.String(), "client disconnected (write failed: broken pipe)") {
+		t.Fatalf("expected the write failure to be logged: %s", output)
+	}
+	if strings.Contains(output.String(), "cancelled via ctx") {
+		t.Fatalf("expected the write failure to be logged distinctly: %s", output)
+	}
+}
+
+func TestEventsMaxDuration(t *testing.T) {
+	//streams that ask for more than the maximum duration are rejected
+	testServer := newTestServer(t, "-max_stream_duration", "1s")
+	rejected := get(t, testServer, "/events?duration=2s")
+	if rejected.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected %d, got %d", http.StatusBadRequest, rejected.StatusCode)
+	}
+	var e response.Error
+	if err := json.NewDecoder(rejected.Body).Decode(&e); err != nil || e.Code != response.CodeBadRequest {
+		t.Fatalf("expected code %q, got %+v (%v)", response.CodeBadRequest, e, err)
+	}
+	if accepted := get(t, testServer, "/events?duration=10ms"); accepted.StatusCode != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, accepted.StatusCode)
+	}
+	//without a maximum, any duration is accepted
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/events?duration=2h", nil)
+	ctx, cancel := context.WithCancel(request.Context())
+	cancel()
+	endpointEvents(io.Discard, writeTimeoutGuard{}, newStreamTracker(), 0)(recorder, request.WithContext(ctx))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, recorder.Code)
+	}
+}
+
+func TestStreamsStopOnShutdown(t *testing.T) {
+	//an active stream is signalled (and closes) when the server shuts
+	// down rather than holding the shutdown for its full duration
+	port := freePort(t)
+	url := "http://127.0.0.1:" + port
+	osSignal, errMain := make(chan os.Signal, 1), make(chan error, 1)
+	go func() {
+		errMain <- Main("", []string{"-address", "127.0.0.1", "-port", port}, map[string]string{},
+			osSignal, WithOutput(io.Discard))
+	}()
+	//keep-alives are disabled so the client doesn't hold connections
+	// that delay the shutdown
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	var stream *http.Response
+	for tStart := time.Now(); stream == nil; time.Sleep(10 * time.Millisecond) {
+		if time.Since(tStart) > 5*time.Second {
+			t.Fatalf("%s isn't serving", url)
+		}
+		stream, _ = client.Get(url + "/events?duration=1m")
+	}
+	defer stream.Body.Close()
+	if contentType := stream.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Fatalf("expected %q, got %q", "text/event-stream", contentType)
+	}
+	osSignal <- syscall.SIGINT
+	body, err := io.ReadAll(stream.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), "event: shutdown\n") {
+		t.Fatalf("expected a shutdown event, got %q", body)
+	}
+	select {
+	case err := <-errMain:
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the stream to close promptly")
+	}
+}
@@ -0,0 +1,38 @@
+package rest_context
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// logGoroutines logs the number of goroutines at the interval, it shows
+// how goroutines accumulate (and drain) under load since each request
+// is served by its own goroutine. The returned function stops logging
+// and blocks until the logger has stopped
+func logGoroutines(log io.Writer, interval time.Duration) (stop func()) {
+	var wg sync.WaitGroup
+
+	stopped := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopped:
+				return
+			case <-ticker.C:
+				fmt.Fprintf(log, "goroutines: %d\n", runtime.NumGoroutine())
+			}
+		}
+	}()
+	return func() {
+		close(stopped)
+		wg.Wait()
+	}
+}
@@ -0,0 +1,45 @@
+package rest_context
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogGoroutines(t *testing.T) {
+	output := &syncBuffer{}
+	stop := logGoroutines(output, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	stop()
+	if !strings.Contains(output.String(), "goroutines: ") {
+		t.Fatalf("expected at least one sample, got %q", output)
+	}
+
+	//once stopped, no further samples are logged
+	samples := output.String()
+	time.Sleep(20 * time.Millisecond)
+	if after := output.String(); after != samples {
+		t.Fatalf("expected no samples after stop, got %q", after)
+	}
+}
+
+func TestNewTestHandlerGoroutines(t *testing.T) {
+	//only Main logs the goroutines, a test handler doesn't sample them
+	output := &syncBuffer{}
+	handler, cleanup, err := NewTestHandler(Config{
+		Args:    []string{"-log_goroutines", "1ms"},
+		Envs:    map[string]string{},
+		Options: []Option{WithOutput(output)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	time.Sleep(20 * time.Millisecond)
+	if strings.Contains(output.String(), "goroutines: ") {
+		t.Fatalf("expected no samples, got %q", output)
+	}
+}
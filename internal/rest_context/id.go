@@ -0,0 +1,137 @@
+package rest_context
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	idFormatUuid  string = "uuid"
+	idFormatShort string = "short"
+	idFormatKsuid string = "ksuid"
+	idFormatUlid  string = "ulid"
+)
+
+const (
+	base62Alphabet string = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	shortIdLength  int    = 12
+	ksuidLength    int    = 27
+	ksuidEpoch     int64  = 1400000000
+	ulidAlphabet   string = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+	ulidLength     int    = 26
+)
+
+type idGenerator interface {
+	Generate() string
+}
+
+type idGeneratorUuid struct{}
+
+func (idGeneratorUuid) Generate() string {
+	return uuid.Must(uuid.NewRandom()).String()
+}
+
+type idGeneratorShort struct{}
+
+func (idGeneratorShort) Generate() string {
+	//use rejection sampling so every character of the alphabet
+	// is equally likely (256 isn't a multiple of 62)
+	var builder strings.Builder
+	buffer := make([]byte, shortIdLength*2)
+	for builder.Len() < shortIdLength {
+		if _, err := rand.Read(buffer); err != nil {
+			panic(err)
+		}
+		for _, b := range buffer {
+			if b >= 248 {
+				continue
+			}
+			builder.WriteByte(base62Alphabet[int(b)%62])
+			if builder.Len() == shortIdLength {
+				break
+			}
+		}
+	}
+	return builder.String()
+}
+
+type idGeneratorKsuid struct{}
+
+func (idGeneratorKsuid) Generate() string {
+	//a ksuid is a 4 byte timestamp (seconds since the ksuid epoch)
+	// followed by 16 random bytes, base62 encoded so that the ids
+	// sort lexicographically by time
+	b := make([]byte, 20)
+	binary.BigEndian.PutUint32(b[:4], uint32(time.Now().Unix()-ksuidEpoch))
+	if _, err := rand.Read(b[4:]); err != nil {
+		panic(err)
+	}
+	return base62Encode(b, ksuidLength)
+}
+
+type idGeneratorUlid struct{}
+
+func (idGeneratorUlid) Generate() string {
+	//a ulid is a 48 bit timestamp (milliseconds since the unix epoch)
+	// followed by 80 random bits, crockford base32 encoded so that the
+	// ids sort lexicographically by time
+	b := make([]byte, 16)
+	ms := uint64(time.Now().UnixMilli())
+	for i := 0; i < 6; i++ {
+		b[i] = byte(ms >> (8 * (5 - i)))
+	}
+	if _, err := rand.Read(b[6:]); err != nil {
+		panic(err)
+	}
+	return ulidEncode(b)
+}
+
+// ulidEncode encodes 128 bits as 26 base32 characters, the first
+// character only holds 3 bits (26*5 = 130 bits)
+func ulidEncode(b []byte) string {
+	encoded := make([]byte, ulidLength)
+	n, mask := new(big.Int).SetBytes(b), big.NewInt(31)
+	for i := ulidLength - 1; i >= 0; i-- {
+		encoded[i] = ulidAlphabet[new(big.Int).And(n, mask).Int64()]
+		n.Rsh(n, 5)
+	}
+	return string(encoded)
+}
+
+func base62Encode(b []byte, length int) string {
+	var encoded []byte
+
+	n, base, mod := new(big.Int).SetBytes(b), big.NewInt(62), new(big.Int)
+	for n.Sign() > 0 {
+		n.DivMod(n, base, mod)
+		encoded = append(encoded, base62Alphabet[mod.Int64()])
+	}
+	for len(encoded) < length {
+		encoded = append(encoded, base62Alphabet[0])
+	}
+	for i, j := 0, len(encoded)-1; i < j; i, j = i+1, j-1 {
+		encoded[i], encoded[j] = encoded[j], encoded[i]
+	}
+	return string(encoded)
+}
+
+func newIdGenerator(format string) (idGenerator, error) {
+	switch format {
+	case idFormatUuid:
+		return idGeneratorUuid{}, nil
+	case idFormatShort:
+		return idGeneratorShort{}, nil
+	case idFormatKsuid:
+		return idGeneratorKsuid{}, nil
+	case idFormatUlid:
+		return idGeneratorUlid{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported id format: %s", format)
+	}
+}
@@ -0,0 +1,52 @@
+package rest_context
+
+import (
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestIdGenerators(t *testing.T) {
+	for format, pattern := range map[string]*regexp.Regexp{
+		idFormatUuid:  regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`),
+		idFormatShort: regexp.MustCompile(`^[0-9A-Za-z]{12}$`),
+		idFormatKsuid: regexp.MustCompile(`^[0-9A-Za-z]{27}$`),
+		idFormatUlid:  regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`),
+	} {
+		idGen, err := newIdGenerator(format)
+		if err != nil {
+			t.Fatalf("%s: %s", format, err)
+		}
+		ids := map[string]bool{}
+		for i := 0; i < 100; i++ {
+			id := idGen.Generate()
+			if !pattern.MatchString(id) {
+				t.Fatalf("%s: unexpected id %q", format, id)
+			}
+			if ids[id] {
+				t.Fatalf("%s: duplicate id %q", format, id)
+			}
+			ids[id] = true
+		}
+	}
+	if _, err := newIdGenerator("unknown"); err == nil {
+		t.Fatal("expected an error for an unsupported format")
+	}
+}
+
+func TestUlidSortable(t *testing.T) {
+	//ids generated milliseconds apart sort chronologically
+	idGen, err := newIdGenerator(idFormatUlid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for i := 0; i < 5; i++ {
+		ids = append(ids, idGen.Generate())
+		time.Sleep(2 * time.Millisecond)
+	}
+	if !sort.StringsAreSorted(ids) {
+		t.Fatalf("expected the ids to be sorted: %v", ids)
+	}
+}
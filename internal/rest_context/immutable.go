@@ -0,0 +1,50 @@
+package rest_context
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/antonio-alexander/go-blog-context/internal/response"
+)
+
+type keyImmutable struct{}
+
+type immutableResponse struct {
+	ParentBefore string `json:"parent_before"`
+	Child        string `json:"child"`
+	ParentAfter  string `json:"parent_after"`
+	Modified     bool   `json:"modified"`
+}
+
+// childValue attempts to "modify" the value stored by the parent, but
+// context.WithValue derives a new context (the parent is never modified)
+// so the new value is only visible to the child (and its children)
+func childValue(ctx context.Context) string {
+	ctx = context.WithValue(ctx, keyImmutable{}, "child")
+	value, _ := ctx.Value(keyImmutable{}).(string)
+	return value
+}
+
+func parentValues(ctx context.Context) immutableResponse {
+	ctx = context.WithValue(ctx, keyImmutable{}, "parent")
+	before, _ := ctx.Value(keyImmutable{}).(string)
+	child := childValue(ctx)
+	after, _ := ctx.Value(keyImmutable{}).(string)
+	return immutableResponse{
+		ParentBefore: before,
+		Child:        child,
+		ParentAfter:  after,
+		Modified:     after != before,
+	}
+}
+
+func endpointImmutable(log io.Writer) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		values := parentValues(request.Context())
+		if err := response.NewEncoder(writer, request).Encode(values); err != nil {
+			fmt.Fprintf(log, "error: %s\n", err.Error())
+		}
+	}
+}
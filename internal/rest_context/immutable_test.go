@@ -0,0 +1,30 @@
+package rest_context
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestParentValues(t *testing.T) {
+	//the child observes its own value, the parent's is unchanged
+	expected := immutableResponse{ParentBefore: "parent", Child: "child", ParentAfter: "parent"}
+	if values := parentValues(context.Background()); values != expected {
+		t.Fatalf("expected %+v, got %+v", expected, values)
+	}
+}
+
+func TestEndpointImmutable(t *testing.T) {
+	resp := get(t, newTestServer(t), "/immutable")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	var values immutableResponse
+	if err := json.NewDecoder(resp.Body).Decode(&values); err != nil {
+		t.Fatal(err)
+	}
+	if values.Modified || values.ParentAfter != values.ParentBefore {
+		t.Fatalf("expected parent value unchanged, got %+v", values)
+	}
+}
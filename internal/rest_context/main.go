@@ -1,101 +1,412 @@
 package rest_context
 
 import (
+	"context"
+	"database/sql"
 	"flag"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"os"
 	"strconv"
-	"sync"
 	"time"
 
-	"github.com/google/uuid"
+	"github.com/antonio-alexander/go-blog-context/internal/config"
+	"github.com/antonio-alexander/go-blog-context/internal/ctxkeys"
+	"github.com/antonio-alexander/go-blog-context/internal/echo"
+	"github.com/antonio-alexander/go-blog-context/internal/middleware"
+	"github.com/antonio-alexander/go-blog-context/internal/response"
+	"github.com/antonio-alexander/go-blog-context/internal/server"
 )
 
-func generateId() string {
-	return uuid.Must(uuid.NewRandom()).String()
+// writeTimeoutGuard detects when a requested timeout meets or exceeds the
+// write timeout of the server; the server would close the connection
+// before the handler could respond (which looks like a connection reset)
+type writeTimeoutGuard struct {
+	writeTimeout time.Duration
+	strict       bool
 }
 
-func endpointTimeout(writer http.ResponseWriter, request *http.Request) {
-	id := generateId()
-	tNow, timeout := time.Now(), time.Minute
-	if s := request.URL.Query().Get("timeout"); s != "" {
-		i, _ := strconv.Atoi(s)
-		timeout = time.Duration(i) * time.Second
-	}
-	fmt.Printf("%s timeout: %v\n", id, timeout)
-	<-time.After(timeout)
-	fmt.Printf("%s completed\n", id)
-	if _, err := fmt.Fprintf(writer, "%s: %v\n", id, time.Since(tNow)); err != nil {
-		fmt.Printf("error (%s): %s", id, err.Error())
+func (w writeTimeoutGuard) check(log io.Writer, id string, timeout time.Duration) error {
+	if w.writeTimeout <= 0 || timeout < w.writeTimeout {
+		return nil
+	}
+	if w.strict {
+		return fmt.Errorf("timeout (%v) exceeds the write timeout (%v)", timeout, w.writeTimeout)
+	}
+	fmt.Fprintf(log, "%s warning: timeout (%v) exceeds the write timeout (%v), the connection will be closed before a response is written\n",
+		id, timeout, w.writeTimeout)
+	return nil
+}
+
+// endpointTimeout intentionally ignores the request context to show that
+// work will continue even if the client disconnects, the only exception
+// is when the server is shutting down (so shutdown doesn't have to wait
+// for the full timeout)
+func endpointTimeout(log io.Writer, guard writeTimeoutGuard) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", middleware.ContentTypeText)
+		id := ctxkeys.RequestId(request.Context())
+		tNow := time.Now()
+		timeout, source, err := ResolveTimeout(request)
+		if err != nil {
+			fmt.Fprintf(log, "error (%s): %s\n", id, err.Error())
+			response.WriteError(writer, http.StatusBadRequest, response.CodeBadRequest, err)
+			return
+		}
+		fmt.Fprintf(log, "%s timeout: %v (%s)\n", id, timeout, source)
+		writer.Header().Set(headerTimeoutSource, string(source))
+		if err := guard.check(log, id, timeout); err != nil {
+			response.WriteError(writer, http.StatusBadRequest, response.CodeBadRequest, err)
+			return
+		}
+		//the request context isn't used to stop the work, only to record
+		// when it was cancelled so the wasted work can be logged
+		cancelled := make(chan time.Time, 1)
+		go func() {
+			<-request.Context().Done()
+			cancelled <- time.Now()
+		}()
+		tWait := time.Now()
+		select {
+		case <-ctxkeys.Shutdown(request.Context()):
+			fmt.Fprintf(log, "%s cancelled via shutdown: %v\n", id, time.Since(tNow))
+			response.WriteError(writer, http.StatusServiceUnavailable, response.CodeShuttingDown, errServerShutdown)
+			return
+		case <-time.After(timeout):
+			fmt.Fprintf(log, "%s completed\n", id)
+		}
+		ctxkeys.Timings(request.Context()).Add("wait", time.Since(tWait))
+		select {
+		default:
+		case tCancelled := <-cancelled:
+			fmt.Fprintln(log, wastedWork(request.Context(), id, tNow, tCancelled))
+		}
+		if _, err := fmt.Fprintf(writer, "%s: %v\n", id, time.Since(tNow)); err != nil {
+			fmt.Fprintf(log, "error (%s): %s", id, err.Error())
+		}
 	}
 }
 
-func endpointTimeoutCtx(writer http.ResponseWriter, request *http.Request) {
-	id := generateId()
-	tNow, timeout := time.Now(), time.Minute
-	if s := request.URL.Query().Get("timeout"); s != "" {
-		i, _ := strconv.Atoi(s)
-		timeout = time.Duration(i) * time.Second
-	}
-	fmt.Printf("%s timeout: %v\n", id, timeout)
-	select {
-	case <-request.Context().Done():
-		fmt.Printf("%s cancelled via ctx: %v\n", id, time.Since(tNow))
-		return
-	case <-time.After(timeout):
-		fmt.Printf("%s completed\n", id)
-	}
-	if _, err := fmt.Fprintf(writer, "%s: %v\n", id, time.Since(tNow)); err != nil {
-		fmt.Printf("error (%s): %s", id, err.Error())
+func endpointTimeoutCtx(log io.Writer, guard writeTimeoutGuard) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", middleware.ContentTypeText)
+		id := ctxkeys.RequestId(request.Context())
+		tNow := time.Now()
+		timeout, source, err := ResolveTimeout(request)
+		if err != nil {
+			fmt.Fprintf(log, "error (%s): %s\n", id, err.Error())
+			response.WriteError(writer, http.StatusBadRequest, response.CodeBadRequest, err)
+			return
+		}
+		fmt.Fprintf(log, "%s timeout: %v (%s)\n", id, timeout, source)
+		writer.Header().Set(headerTimeoutSource, string(source))
+		if err := guard.check(log, id, timeout); err != nil {
+			response.WriteError(writer, http.StatusBadRequest, response.CodeBadRequest, err)
+			return
+		}
+		tWait := time.Now()
+		select {
+		case <-request.Context().Done():
+			reason := cancellationReason(request.Context())
+			fmt.Fprintf(log, "%s cancelled via ctx (%s, %s): %v\n", id, reason, ctxkeys.Proto(request.Context()), time.Since(tNow))
+			writeCancellation(writer, request.Context())
+			return
+		case <-time.After(timeout):
+			fmt.Fprintf(log, "%s completed\n", id)
+		}
+		ctxkeys.Timings(request.Context()).Add("wait", time.Since(tWait))
+		if _, err := fmt.Fprintf(writer, "%s: %v\n", id, time.Since(tNow)); err != nil {
+			fmt.Fprintf(log, "error (%s): %s", id, err.Error())
+		}
 	}
 }
 
-func Main(pwd string, args []string, envs map[string]string, osSignal chan os.Signal) error {
-	var httpAddress, httpPort string
-	var wg sync.WaitGroup
+// configure parses the configuration (args and environment) and creates
+// the dependencies of the server, the returned function releases them
+// once the server has stopped
+func configure(args []string, envs map[string]string, o options) (server.Config, http.Handler, time.Duration, func(), error) {
+	var requireHTTPS, trustedProxies, echoHeaders, requestIdHeader string
+	var dbDSN, routeTimeouts string
+	var idFormat, contentType string
+	var maxRequestDuration, maxStreamDuration, goroutinesInterval time.Duration
+	var strictTimeouts, ui, debugBodies bool
+	var debugBodyLimit, timeoutMaxInflight int
+	var traceSample float64
+	var serverConfig server.Config
+	var closers []func()
 	var err error
 
 	//get address/port from args
 	cli := flag.NewFlagSet("", flag.ContinueOnError)
-	cli.StringVar(&httpAddress, "address", "", "http address")
-	cli.StringVar(&httpPort, "port", "8080", "http port")
+	serverConfig.Flags(cli)
+	cli.StringVar(&idFormat, "id_format", idFormatUuid, "request id format (uuid, short, ksuid, ulid)")
+	cli.StringVar(&contentType, "content_type", middleware.DefaultContentType, "default response content type")
+	cli.DurationVar(&serverConfig.WriteTimeout, "write_timeout", 0, "http write timeout (0 disables the timeout)")
+	cli.BoolVar(&strictTimeouts, "strict_timeouts", false, "reject requests whose timeout exceeds the write timeout")
+	cli.StringVar(&requireHTTPS, "require_https", middleware.HTTPSModeDisabled, "redirect or reject requests not made over https")
+	cli.StringVar(&trustedProxies, "trusted_proxies", "", "comma separated ips/cidrs of proxies trusted to set X-Forwarded-Proto")
+	cli.BoolVar(&ui, "ui", false, "serve the demo ui at / (the non ctx endpoint moves to /timeout)")
+	cli.DurationVar(&maxRequestDuration, "max_request_duration", 0, "maximum duration of a request regardless of its timeout (0 disables it)")
+	cli.BoolVar(&debugBodies, "debug_bodies", false, "log (truncated) request and response bodies")
+	cli.DurationVar(&goroutinesInterval, "log_goroutines", 0, "interval the number of goroutines is logged at (0 disables it)")
+	cli.Float64Var(&traceSample, "trace_sample", 0, "rate of requests sampled for debug logging (0-1), X-Debug is honored from trusted proxies")
+	cli.IntVar(&debugBodyLimit, "debug_body_limit", 1024, "maximum number of bytes logged for each body")
+	cli.BoolVar(&serverConfig.H2C, "h2c", false, "enable cleartext http/2 (h2c)")
+	cli.IntVar(&timeoutMaxInflight, "timeout_max_inflight", 0, "maximum concurrent requests of the non ctx endpoint (0 disables it)")
+	cli.StringVar(&echoHeaders, "echo_headers", echo.DefaultHeaders, "comma separated headers reflected by /echo")
+	cli.StringVar(&requestIdHeader, "request_id_header", middleware.HeaderRequestId, "header the request id is read from and written to")
+	cli.StringVar(&dbDSN, "db_dsn", "", "postgres dsn used by /db (the endpoint is disabled if empty)")
+	cli.DurationVar(&maxStreamDuration, "max_stream_duration", 0, "maximum duration of a stream (0 disables it)")
+	cli.StringVar(&routeTimeouts, "route_timeouts", "", "default timeout of each route (e.g., /ctx=60s,/=30s)")
 	if err := cli.Parse(args); err != nil {
-		return err
+		return server.Config{}, nil, 0, nil, err
 	}
 
 	//get address/port from env (overrides args)
-	if _, ok := envs["HTTP_PORT"]; ok {
-		httpPort = envs["HTTP_PORT"]
+	if err := serverConfig.Envs(envs); err != nil {
+		return server.Config{}, nil, 0, nil, err
 	}
-	if _, ok := envs["HTTP_ADDRESS"]; ok {
-		httpAddress = envs["HTTP_ADDRESS"]
+	if _, ok := envs["ID_FORMAT"]; ok {
+		idFormat = envs["ID_FORMAT"]
+	}
+	if _, ok := envs["CONTENT_TYPE"]; ok {
+		contentType = envs["CONTENT_TYPE"]
+	}
+	if _, ok := envs["REQUIRE_HTTPS"]; ok {
+		requireHTTPS = envs["REQUIRE_HTTPS"]
+	}
+	if _, ok := envs["TRUSTED_PROXIES"]; ok {
+		trustedProxies = envs["TRUSTED_PROXIES"]
+	}
+	if _, ok := envs["DEBUG_BODIES"]; ok {
+		if debugBodies, err = strconv.ParseBool(envs["DEBUG_BODIES"]); err != nil {
+			return server.Config{}, nil, 0, nil, err
+		}
+	}
+	if _, ok := envs["DEBUG_BODY_LIMIT"]; ok {
+		if debugBodyLimit, err = strconv.Atoi(envs["DEBUG_BODY_LIMIT"]); err != nil {
+			return server.Config{}, nil, 0, nil, err
+		}
+	}
+	if _, ok := envs["WRITE_TIMEOUT"]; ok {
+		if serverConfig.WriteTimeout, err = time.ParseDuration(envs["WRITE_TIMEOUT"]); err != nil {
+			return server.Config{}, nil, 0, nil, err
+		}
+	}
+	if _, ok := envs["UI"]; ok {
+		if ui, err = strconv.ParseBool(envs["UI"]); err != nil {
+			return server.Config{}, nil, 0, nil, err
+		}
+	}
+	if _, ok := envs["MAX_REQUEST_DURATION"]; ok {
+		if maxRequestDuration, err = time.ParseDuration(envs["MAX_REQUEST_DURATION"]); err != nil {
+			return server.Config{}, nil, 0, nil, err
+		}
+	}
+	if _, ok := envs["STRICT_TIMEOUTS"]; ok {
+		if strictTimeouts, err = strconv.ParseBool(envs["STRICT_TIMEOUTS"]); err != nil {
+			return server.Config{}, nil, 0, nil, err
+		}
+	}
+	if _, ok := envs["H2C"]; ok {
+		if serverConfig.H2C, err = strconv.ParseBool(envs["H2C"]); err != nil {
+			return server.Config{}, nil, 0, nil, err
+		}
+	}
+	if _, ok := envs["TIMEOUT_MAX_INFLIGHT"]; ok {
+		if timeoutMaxInflight, err = strconv.Atoi(envs["TIMEOUT_MAX_INFLIGHT"]); err != nil {
+			return server.Config{}, nil, 0, nil, err
+		}
+	}
+	if _, ok := envs["ECHO_HEADERS"]; ok {
+		echoHeaders = envs["ECHO_HEADERS"]
+	}
+	if _, ok := envs["REQUEST_ID_HEADER"]; ok {
+		requestIdHeader = envs["REQUEST_ID_HEADER"]
+	}
+	if _, ok := envs["DB_DSN"]; ok {
+		dbDSN = envs["DB_DSN"]
+	}
+	if _, ok := envs["MAX_STREAM_DURATION"]; ok {
+		if maxStreamDuration, err = time.ParseDuration(envs["MAX_STREAM_DURATION"]); err != nil {
+			return server.Config{}, nil, 0, nil, err
+		}
+	}
+	if _, ok := envs["ROUTE_TIMEOUTS"]; ok {
+		routeTimeouts = envs["ROUTE_TIMEOUTS"]
+	}
+	if _, ok := envs["TRACE_SAMPLE"]; ok {
+		if traceSample, err = strconv.ParseFloat(envs["TRACE_SAMPLE"], 64); err != nil {
+			return server.Config{}, nil, 0, nil, err
+		}
+	}
+	if _, ok := envs["LOG_GOROUTINES"]; ok {
+		if goroutinesInterval, err = time.ParseDuration(envs["LOG_GOROUTINES"]); err != nil {
+			return server.Config{}, nil, 0, nil, err
+		}
+	}
+	serverConfig.Sources = config.Sources(cli, envs, server.EnvNames)
+
+	//validate the configuration and create dependencies
+	proxies, err := middleware.ParseTrustedProxies(trustedProxies)
+	if err != nil {
+		return server.Config{}, nil, 0, nil, err
+	}
+	httpsOnly, err := middleware.HTTPSOnly(requireHTTPS, proxies, server.AdminPaths...)
+	if err != nil {
+		return server.Config{}, nil, 0, nil, err
+	}
+	sample, err := middleware.Sample(traceSample, proxies)
+	if err != nil {
+		return server.Config{}, nil, 0, nil, err
+	}
+	defaultTimeouts, err := middleware.ParseRouteTimeouts(routeTimeouts)
+	if err != nil {
+		return server.Config{}, nil, 0, nil, err
+	}
+	log := o.output
+	guard := writeTimeoutGuard{
+		writeTimeout: serverConfig.WriteTimeout,
+		strict:       strictTimeouts,
+	}
+
+	//select the id generator once at startup so each request
+	// only pays for generating the (request) id
+	idGen, err := newIdGenerator(idFormat)
+	if err != nil {
+		return server.Config{}, nil, 0, nil, err
 	}
 
 	//generate and create handle func, when connecting, it will use this port
 	// indicate via console that the webserver is starting
-	http.HandleFunc("/", endpointTimeout)
-	http.HandleFunc("/ctx", endpointTimeoutCtx)
-	server := &http.Server{
-		Addr:    httpAddress + ":" + httpPort,
-		Handler: nil,
-	}
-	fmt.Printf("starting web server on %s:%s\n", httpAddress, httpPort)
-	stopped := make(chan struct{})
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		defer close(stopped)
-
-		if err = server.ListenAndServe(); err != nil {
-			return
+	// use a local mux (rather than the default mux) so multiple servers
+	// can co-exist within the same process
+	mux := http.NewServeMux()
+	//the ui and the non ctx endpoint both want the root (/), when the ui
+	// is enabled the non ctx endpoint is moved to /timeout
+	// the maximum request duration is applied to each (non-streaming)
+	// endpoint to bound endpoints that ignore the request context
+	// the non ctx endpoint's concurrency is limited within the maximum
+	// duration since its goroutine outlives the timeout handler
+	maxDuration := middleware.MaxDuration(maxRequestDuration)
+	timeoutHandler := maxDuration(middleware.MaxInFlight(timeoutMaxInflight)(
+		http.HandlerFunc(endpointTimeout(log, guard))))
+	if ui {
+		mux.Handle("/", uiHandler())
+		mux.Handle("/timeout", timeoutHandler)
+	} else {
+		mux.Handle("/", timeoutHandler)
+	}
+	mux.Handle("/ctx", maxDuration(http.HandlerFunc(endpointTimeoutCtx(log, guard))))
+	mux.HandleFunc("/ctxvalues", endpointCtxValues(log))
+	mux.HandleFunc("/immutable", endpointImmutable(log))
+	mux.HandleFunc("/echo", echo.Handler(echo.ParseHeaders(echoHeaders)))
+	streams := newStreamTracker()
+	mux.HandleFunc("/events", endpointEvents(log, guard, streams, maxStreamDuration))
+	//the route is registered regardless so it doesn't fall through
+	// to the non ctx endpoint (at /) when it's disabled
+	if dbDSN != "" {
+		db, err := sql.Open(dbDriver, dbDSN)
+		if err != nil {
+			return server.Config{}, nil, 0, nil, err
+		}
+		closers = append(closers, func() { db.Close() })
+		mux.Handle("/db", maxDuration(http.HandlerFunc(endpointDB(log, db, guard))))
+	} else {
+		mux.Handle("/db", http.NotFoundHandler())
+	}
+	ctxShutdown, cancelShutdown := context.WithCancelCause(context.Background())
+	closers = append(closers, func() { cancelShutdown(nil) })
+	serverConfig.Middleware = []middleware.Middleware{
+		httpsOnly,
+		middleware.RequestId(requestIdHeader, idGen.Generate),
+		middleware.Proto,
+		middleware.ServerTiming,
+		sample,
+		middleware.ContentType(contentType),
+		middleware.DebugBodies(debugBodies, debugBodyLimit),
+	}
+	serverConfig.BaseContext = func(net.Listener) context.Context {
+		//the shutdown channel is communicated via the base context of the
+		// server and is independent of the connection (i.e., a client
+		// disconnecting won't close it)
+		return ctxkeys.WithShutdown(ctxShutdown, ctxShutdown.Done())
+	}
+	//shutdown is ordered: once the listeners are closed (no new connections)
+	// the streams are signalled to send a final event and close, once they've
+	// closed, the base context is cancelled so in-flight requests stop waiting
+	serverConfig.OnShutdown = func() {
+		streams.stopAndWait()
+		cancelShutdown(errServerShutdown)
+	}
+	serverConfig.OnStopped = o.onStopped
+	serverConfig.Summary = map[string]any{
+		"id_format":            idFormat,
+		"content_type":         contentType,
+		"strict_timeouts":      strictTimeouts,
+		"max_request_duration": maxRequestDuration.String(),
+		"log_goroutines":       goroutinesInterval.String(),
+		"require_https":        requireHTTPS,
+		"trusted_proxies":      trustedProxies,
+		"trace_sample":         traceSample,
+		"debug_bodies":         debugBodies,
+		"debug_body_limit":     debugBodyLimit,
+		"ui":                   ui,
+		"timeout_max_inflight": timeoutMaxInflight,
+		"request_id_header":    requestIdHeader,
+		"db_dsn":               config.Redact(dbDSN),
+		"max_stream_duration":  maxStreamDuration.String(),
+		"route_timeouts":       routeTimeouts,
+		"echo_headers":         echoHeaders,
+	}
+	cleanup := func() {
+		for i := len(closers) - 1; i >= 0; i-- {
+			closers[i]()
 		}
-	}()
-	select {
-	case <-stopped:
-	case <-osSignal:
-		err = server.Close()
 	}
-	wg.Wait()
-	return err
+	return serverConfig, middleware.RouteTimeouts(mux, defaultTimeouts), goroutinesInterval, cleanup, nil
+}
+
+func Main(pwd string, args []string, envs map[string]string, osSignal chan os.Signal, opts ...Option) error {
+	o := newOptions(opts)
+	serverConfig, handler, goroutinesInterval, cleanup, err := configure(args, envs, o)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	if goroutinesInterval > 0 {
+		//the goroutines are logged until the server has shutdown so
+		// they can be seen draining
+		defer logGoroutines(o.output, goroutinesInterval)()
+	}
+	return server.Run(serverConfig, handler, osSignal)
+}
+
+// Config is the configuration of the application as it's provided to
+// Main (the args and the environment) along with its options
+type Config struct {
+	Args    []string
+	Envs    map[string]string
+	Options []Option
+}
+
+// NewTestHandler returns the handler served by Main without a listener so
+// the whole server can be tested in memory (e.g., with httptest.NewServer),
+// the endpoints and the middleware are wrapped by server.Handler which adds
+// the admin endpoints. The goroutines aren't logged (only Main does) and
+// the cleanup releases the dependencies (e.g., the db)
+// and should be called once the handler is no longer used
+func NewTestHandler(cfg Config) (http.Handler, func(), error) {
+	serverConfig, handler, _, cleanup, err := configure(cfg.Args, cfg.Envs, newOptions(cfg.Options))
+	if err != nil {
+		return nil, nil, err
+	}
+	testHandler, err := server.Handler(serverConfig, handler)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return testHandler, cleanup, nil
 }
@@ -0,0 +1,358 @@
+package rest_context
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/antonio-alexander/go-blog-context/internal/config"
+	"github.com/antonio-alexander/go-blog-context/internal/ctxkeys"
+	"github.com/antonio-alexander/go-blog-context/internal/response"
+	"github.com/antonio-alexander/go-blog-context/internal/server"
+)
+
+func decodeError(t *testing.T, recorder *httptest.ResponseRecorder) response.Error {
+	t.Helper()
+	var e response.Error
+	if err := json.NewDecoder(recorder.Body).Decode(&e); err != nil {
+		t.Fatalf("expected a json error envelope, got %q: %s", recorder.Body.String(), err)
+	}
+	return e
+}
+
+func TestEndpointTimeoutErrors(t *testing.T) {
+	guard := writeTimeoutGuard{writeTimeout: time.Second, strict: true}
+	for name, endpoint := range map[string]http.HandlerFunc{
+		"timeout":     endpointTimeout(io.Discard, guard),
+		"timeout_ctx": endpointTimeoutCtx(io.Discard, guard),
+	} {
+		for _, target := range []string{"/?timeout=abc", "/?timeout=2s"} {
+			recorder := httptest.NewRecorder()
+			endpoint(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+			if recorder.Code != http.StatusBadRequest {
+				t.Fatalf("%s %s: expected %d, got %d", name, target, http.StatusBadRequest, recorder.Code)
+			}
+			if contentType := recorder.Header().Get("Content-Type"); contentType != response.ContentTypeJSON {
+				t.Fatalf("%s %s: expected content type %q, got %q", name, target, response.ContentTypeJSON, contentType)
+			}
+			if e := decodeError(t, recorder); e.Code != response.CodeBadRequest {
+				t.Fatalf("%s %s: expected code %q, got %q", name, target, response.CodeBadRequest, e.Code)
+			}
+		}
+	}
+}
+
+func TestWriteCancellation(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	recorder := httptest.NewRecorder()
+	writeCancellation(recorder, ctx)
+	if recorder.Code != http.StatusGatewayTimeout {
+		t.Fatalf("expected %d, got %d", http.StatusGatewayTimeout, recorder.Code)
+	}
+	if e := decodeError(t, recorder); e.Code != response.CodeTimeout {
+		t.Fatalf("expected code %q, got %q", response.CodeTimeout, e.Code)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	recorder = httptest.NewRecorder()
+	writeCancellation(recorder, ctx)
+	if recorder.Code != statusClientClosedRequest {
+		t.Fatalf("expected %d, got %d", statusClientClosedRequest, recorder.Code)
+	}
+	if recorder.Body.Len() != 0 {
+		t.Fatalf("expected no body, got %q", recorder.Body.String())
+	}
+}
+
+// newTestServer serves the whole application (as built by NewTestHandler
+// with the args) without Main's lifecycle
+func newTestServer(t *testing.T, args ...string) *httptest.Server {
+	t.Helper()
+
+	handler, cleanup, err := NewTestHandler(Config{Args: args, Envs: map[string]string{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cleanup)
+	testServer := httptest.NewServer(handler)
+	t.Cleanup(testServer.Close)
+	return testServer
+}
+
+// get requests the path from the test server
+func get(t *testing.T, testServer *httptest.Server, path string) *http.Response {
+	t.Helper()
+
+	response, err := testServer.Client().Get(testServer.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { response.Body.Close() })
+	return response
+}
+
+func TestNewTestHandler(t *testing.T) {
+	testServer := newTestServer(t, "-request_id_header", "X-Correlation-ID")
+	ctxValues := get(t, testServer, "/ctxvalues")
+	if ctxValues.StatusCode != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, ctxValues.StatusCode)
+	}
+	if ctxValues.Header.Get("X-Correlation-ID") == "" {
+		t.Fatal("expected the configured request id header")
+	}
+	if readyz := get(t, testServer, "/readyz"); readyz.StatusCode != http.StatusOK {
+		t.Fatalf("expected the admin endpoints to be served, got %d", readyz.StatusCode)
+	}
+	//the error envelope is the same through the whole middleware chain
+	badTimeout := get(t, testServer, "/ctx?timeout=abc")
+	if badTimeout.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected %d, got %d", http.StatusBadRequest, badTimeout.StatusCode)
+	}
+	var e response.Error
+	if err := json.NewDecoder(badTimeout.Body).Decode(&e); err != nil || e.Code != response.CodeBadRequest {
+		t.Fatalf("expected code %q, got %+v (%v)", response.CodeBadRequest, e, err)
+	}
+}
+
+func TestWithOutput(t *testing.T) {
+	output := &syncBuffer{}
+	handler, cleanup, err := NewTestHandler(Config{
+		Envs:    map[string]string{},
+		Options: []Option{WithOutput(output)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	testServer := httptest.NewServer(handler)
+	defer testServer.Close()
+	if completed := get(t, testServer, "/ctx?timeout=1ms"); completed.StatusCode != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, completed.StatusCode)
+	}
+	if !strings.Contains(output.String(), "completed") {
+		t.Fatalf("expected the logs to be written to the output, got %q", output)
+	}
+}
+
+func TestEndpointTimeoutShutdown(t *testing.T) {
+	//the non ctx endpoint ignores the request context, but stops waiting
+	// (with a 503) once the server is shutting down
+	shutdown := make(chan struct{})
+	ctx := ctxkeys.WithShutdown(context.Background(), shutdown)
+	request := httptest.NewRequest(http.MethodGet, "/?timeout=1m", nil).WithContext(ctx)
+	recorder := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		endpointTimeout(io.Discard, writeTimeoutGuard{})(recorder, request)
+	}()
+	close(shutdown)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected the endpoint to stop waiting on shutdown")
+	}
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected %d, got %d", http.StatusServiceUnavailable, recorder.Code)
+	}
+	if e := decodeError(t, recorder); e.Code != response.CodeShuttingDown {
+		t.Fatalf("expected code %q, got %q", response.CodeShuttingDown, e.Code)
+	}
+}
+
+// freePort returns a loopback port that's free (at the time it's called)
+func freePort(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return port
+}
+
+// syncBuffer is a buffer that's safe for concurrent use, so the logs
+// of handlers (and their goroutines) can be captured
+type syncBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (s *syncBuffer) Write(b []byte) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.buffer.Write(b)
+}
+
+func (s *syncBuffer) String() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.buffer.String()
+}
+
+func TestWriteTimeoutGuard(t *testing.T) {
+	for name, c := range map[string]struct {
+		guard   writeTimeoutGuard
+		timeout time.Duration
+		err     bool
+		warning bool
+	}{
+		"disabled":        {guard: writeTimeoutGuard{}, timeout: time.Hour},
+		"within":          {guard: writeTimeoutGuard{writeTimeout: time.Second}, timeout: 999 * time.Millisecond},
+		"exceeds":         {guard: writeTimeoutGuard{writeTimeout: time.Second}, timeout: time.Second, warning: true},
+		"exceeds_strict":  {guard: writeTimeoutGuard{writeTimeout: time.Second, strict: true}, timeout: 2 * time.Second, err: true},
+		"within_strict":   {guard: writeTimeoutGuard{writeTimeout: time.Second, strict: true}, timeout: time.Millisecond},
+		"disabled_strict": {guard: writeTimeoutGuard{strict: true}, timeout: time.Hour},
+	} {
+		output := &syncBuffer{}
+		err := c.guard.check(output, "id", c.timeout)
+		if (err != nil) != c.err {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if warning := strings.Contains(output.String(), "warning"); warning != c.warning {
+			t.Fatalf("%s: unexpected output: %q", name, output)
+		}
+	}
+}
+
+func TestMaxRequestDuration(t *testing.T) {
+	//the non ctx endpoint ignores the request context, the maximum
+	// request duration bounds it regardless
+	output := &syncBuffer{}
+	handler, cleanup, err := NewTestHandler(Config{
+		Args:    []string{"-max_request_duration", "50ms"},
+		Envs:    map[string]string{},
+		Options: []Option{WithOutput(output)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	testServer := httptest.NewServer(handler)
+	defer testServer.Close()
+	tStart := time.Now()
+	bounded := get(t, testServer, "/?timeout=200ms")
+	if elapsed := time.Since(tStart); elapsed >= 200*time.Millisecond {
+		t.Fatalf("expected the request to be bounded, took %v", elapsed)
+	}
+	if bounded.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected %d, got %d", http.StatusServiceUnavailable, bounded.StatusCode)
+	}
+	var e response.Error
+	if err := json.NewDecoder(bounded.Body).Decode(&e); err != nil || e.Code != response.CodeTimeout {
+		t.Fatalf("expected code %q, got %+v (%v)", response.CodeTimeout, e, err)
+	}
+
+	//the endpoint keeps working after the response has been written,
+	// wait for it to return so it doesn't outlive the test; the last
+	// thing it does is fail to write (the request has timed out)
+	for !strings.Contains(output.String(), http.ErrHandlerTimeout.Error()) {
+		if time.Since(tStart) > 5*time.Second {
+			t.Fatal("expected the endpoint to complete")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestTimeoutMaxInflight(t *testing.T) {
+	//the limit only applies to the non ctx endpoint
+	testServer := newTestServer(t, "-timeout_max_inflight", "1")
+	errRequest := make(chan error, 1)
+	go func() {
+		response, err := testServer.Client().Get(testServer.URL + "/?timeout=300ms")
+		if err == nil {
+			response.Body.Close()
+		}
+		errRequest <- err
+	}()
+	for tStart := time.Now(); ; time.Sleep(time.Millisecond) {
+		var inflight map[string]int64
+		if err := json.NewDecoder(get(t, testServer, "/inflight").Body).Decode(&inflight); err != nil {
+			t.Fatal(err)
+		}
+		if inflight["inflight"] == 1 {
+			break
+		}
+		if time.Since(tStart) > time.Second {
+			t.Fatal("expected the request to be in-flight")
+		}
+	}
+	busy := get(t, testServer, "/?timeout=1ms")
+	if busy.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected %d, got %d", http.StatusServiceUnavailable, busy.StatusCode)
+	}
+	var e response.Error
+	if err := json.NewDecoder(busy.Body).Decode(&e); err != nil || e.Code != response.CodeServerBusy {
+		t.Fatalf("expected code %q, got %+v (%v)", response.CodeServerBusy, e, err)
+	}
+	if ctx := get(t, testServer, "/ctx?timeout=1ms"); ctx.StatusCode != http.StatusOK {
+		t.Fatalf("expected the ctx endpoint not to be limited, got %d", ctx.StatusCode)
+	}
+	if err := <-errRequest; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfigSources(t *testing.T) {
+	//overriding the port via the environment is reported as such
+	handler, cleanup, err := NewTestHandler(Config{
+		Args: []string{"-port", "8081", "-ui"},
+		Envs: map[string]string{"HTTP_PORT": "9090"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/config", nil))
+	var cfg struct {
+		Config  map[string]any    `json:"config"`
+		Sources map[string]string `json:"sources"`
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]struct {
+		value  any
+		source string
+	}{
+		"port":          {"9090", config.SourceEnv},
+		"ui":            {true, config.SourceFlag},
+		"write_timeout": {"0s", config.SourceDefault},
+	} {
+		if cfg.Config[name] != expected.value || cfg.Sources[name] != expected.source {
+			t.Fatalf("%s: expected %v (%s), got %v (%s)", name, expected.value, expected.source, cfg.Config[name], cfg.Sources[name])
+		}
+	}
+}
+
+func TestRequireHTTPSAdminEndpoints(t *testing.T) {
+	//probes of the admin endpoints are made over plain http
+	testServer := newTestServer(t, "-require_https", "reject")
+	for _, path := range server.AdminPaths {
+		if admin := get(t, testServer, path); admin.StatusCode != http.StatusOK {
+			t.Fatalf("%s: expected %d, got %d", path, http.StatusOK, admin.StatusCode)
+		}
+	}
+	if rejected := get(t, testServer, "/ctxvalues"); rejected.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected %d, got %d", http.StatusBadRequest, rejected.StatusCode)
+	}
+}
@@ -0,0 +1,46 @@
+package rest_context
+
+import (
+	"context"
+	"io"
+	"os"
+)
+
+// Option configures Main beyond its flags and environment (e.g., when
+// the application is embedded)
+type Option func(*options)
+
+type options struct {
+	onStopped func(ctx context.Context) error
+	output    io.Writer
+}
+
+// newOptions applies the options over the defaults
+func newOptions(opts []Option) options {
+	var o options
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.output == nil {
+		o.output = os.Stdout
+	}
+	return o
+}
+
+// WithOnStopped sets a function that's executed once the server has
+// stopped serving (before Main returns), its context has the deadline
+// of the shutdown (e.g., to flush buffers or close resources)
+func WithOnStopped(onStopped func(ctx context.Context) error) Option {
+	return func(o *options) {
+		o.onStopped = onStopped
+	}
+}
+
+// WithOutput sets where the application logs (e.g., how long a request
+// waited) are written, by default they're written to stdout
+func WithOutput(output io.Writer) Option {
+	return func(o *options) {
+		o.output = output
+	}
+}
@@ -0,0 +1,55 @@
+package rest_context
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/antonio-alexander/go-blog-context/internal/ctxkeys"
+	"github.com/antonio-alexander/go-blog-context/internal/query"
+)
+
+// TimeoutSource identifies where the timeout of a request came from
+type TimeoutSource string
+
+const (
+	SourceDefault TimeoutSource = "default"
+	SourceQuery   TimeoutSource = "query"
+	SourceHeader  TimeoutSource = "header"
+)
+
+const (
+	headerTimeout       string        = "X-Timeout"
+	headerTimeoutSource string        = "X-Timeout-Source"
+	defaultTimeout      time.Duration = 60 * time.Second
+)
+
+type timeoutQuery struct {
+	Timeout time.Duration `query:"timeout"`
+}
+
+// ResolveTimeout returns the timeout of the request and its source, the
+// timeout is either a duration string (e.g., 1m30s) or seconds; the
+// X-Timeout header takes precedence over the timeout query parameter,
+// if neither are present (or they're empty) the default timeout (of the
+// route if it's been configured) is used
+func ResolveTimeout(request *http.Request) (time.Duration, TimeoutSource, error) {
+	if value := request.Header.Get(headerTimeout); value != "" {
+		timeout, err := query.ParseDuration(value)
+		if err != nil {
+			return 0, SourceHeader, fmt.Errorf("invalid %s header: %s", headerTimeout, value)
+		}
+		return timeout, SourceHeader, nil
+	}
+	if request.URL.Query().Get("timeout") == "" {
+		if timeout, ok := ctxkeys.DefaultTimeout(request.Context()); ok {
+			return timeout, SourceDefault, nil
+		}
+		return defaultTimeout, SourceDefault, nil
+	}
+	var params timeoutQuery
+	if err := query.DecodeQuery(request, &params); err != nil {
+		return 0, SourceQuery, err
+	}
+	return params.Timeout, SourceQuery, nil
+}
@@ -0,0 +1,54 @@
+package rest_context
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/antonio-alexander/go-blog-context/internal/ctxkeys"
+)
+
+func TestResolveTimeout(t *testing.T) {
+	for _, c := range []struct {
+		name         string
+		target       string
+		header       string
+		routeTimeout time.Duration
+		timeout      time.Duration
+		source       TimeoutSource
+		err          bool
+	}{
+		{name: "default", target: "/", timeout: defaultTimeout, source: SourceDefault},
+		{name: "route_default", target: "/", routeTimeout: 5 * time.Second, timeout: 5 * time.Second, source: SourceDefault},
+		{name: "empty_query", target: "/?timeout=", timeout: defaultTimeout, source: SourceDefault},
+		{name: "empty_query_route", target: "/?timeout=", routeTimeout: 5 * time.Second, timeout: 5 * time.Second, source: SourceDefault},
+		{name: "query", target: "/?timeout=2s", timeout: 2 * time.Second, source: SourceQuery},
+		{name: "query_seconds", target: "/?timeout=3", timeout: 3 * time.Second, source: SourceQuery},
+		{name: "query_over_route", target: "/?timeout=2s", routeTimeout: 5 * time.Second, timeout: 2 * time.Second, source: SourceQuery},
+		{name: "header", target: "/", header: "4s", timeout: 4 * time.Second, source: SourceHeader},
+		{name: "header_over_query", target: "/?timeout=2s", header: "4s", timeout: 4 * time.Second, source: SourceHeader},
+		{name: "invalid_header", target: "/?timeout=2s", header: "abc", source: SourceHeader, err: true},
+		{name: "invalid_query", target: "/?timeout=abc", source: SourceQuery, err: true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, c.target, nil)
+			if c.header != "" {
+				request.Header.Set(headerTimeout, c.header)
+			}
+			if c.routeTimeout > 0 {
+				request = request.WithContext(ctxkeys.WithDefaultTimeout(request.Context(), c.routeTimeout))
+			}
+			timeout, source, err := ResolveTimeout(request)
+			if (err != nil) != c.err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if source != c.source {
+				t.Fatalf("expected source %q, got %q", c.source, source)
+			}
+			if !c.err && timeout != c.timeout {
+				t.Fatalf("expected %v, got %v", c.timeout, timeout)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package rest_context
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestUI(t *testing.T) {
+	testServer := newTestServer(t, "-ui")
+	page := get(t, testServer, "/")
+	if page.StatusCode != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, page.StatusCode)
+	}
+	if contentType := page.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/html") {
+		t.Fatalf("expected html, got %q", contentType)
+	}
+	body, err := io.ReadAll(page.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, form := range []string{"mint()", "audit()", "start('/timeout')", "start('/ctx')", "cancel()"} {
+		if !strings.Contains(string(body), form) {
+			t.Fatalf("expected the page to have %s", form)
+		}
+	}
+	//the non ctx endpoint is moved to /timeout
+	if response := get(t, testServer, "/timeout?timeout=abc"); response.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected %d, got %d", http.StatusBadRequest, response.StatusCode)
+	}
+
+	//without the ui, the non ctx endpoint is served at the root
+	testServer = newTestServer(t)
+	if response := get(t, testServer, "/?timeout=abc"); response.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected %d, got %d", http.StatusBadRequest, response.StatusCode)
+	}
+}
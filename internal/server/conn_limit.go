@@ -0,0 +1,78 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"sync"
+)
+
+// connLimitListener limits the number of concurrent connections from
+// each client ip, connections beyond the limit are closed as soon as
+// they're accepted (the ip of the connection is used, not forwarded
+// headers since they're only available once a request is read)
+type connLimitListener struct {
+	net.Listener
+	sync.Mutex
+	max   int
+	conns map[string]int
+}
+
+func newConnLimitListener(listener net.Listener, max int) *connLimitListener {
+	return &connLimitListener{
+		Listener: listener,
+		max:      max,
+		conns:    make(map[string]int),
+	}
+}
+
+func (c *connLimitListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := c.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		ip := conn.RemoteAddr().String()
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+		if !c.acquire(ip) {
+			fmt.Printf("rejected connection from %s: it already has %d connections\n", ip, c.max)
+			conn.Close()
+			continue
+		}
+		return &limitedConn{Conn: conn, release: func() { c.release(ip) }}, nil
+	}
+}
+
+func (c *connLimitListener) acquire(ip string) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.conns[ip] >= c.max {
+		return false
+	}
+	c.conns[ip]++
+	return true
+}
+
+func (c *connLimitListener) release(ip string) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.conns[ip]--; c.conns[ip] <= 0 {
+		delete(c.conns, ip)
+	}
+}
+
+// limitedConn releases its connection (once) when it's closed
+type limitedConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (l *limitedConn) Close() error {
+	err := l.Conn.Close()
+	l.once.Do(l.release)
+	return err
+}
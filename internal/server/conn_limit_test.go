@@ -0,0 +1,74 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConnLimitListener(t *testing.T) {
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener := newConnLimitListener(tcpListener, 1)
+	defer listener.Close()
+	accepted := make(chan net.Conn)
+	go func() {
+		defer close(accepted)
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+	dial := func() net.Conn {
+		conn, err := net.Dial("tcp", tcpListener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+	accept := func() net.Conn {
+		select {
+		case conn := <-accepted:
+			return conn
+		case <-time.After(time.Second):
+			t.Fatal("expected the connection to be accepted")
+			return nil
+		}
+	}
+
+	dial()
+	conn := accept()
+
+	//a connection beyond the limit is closed as soon as it's accepted
+	rejected := dial()
+	rejected.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := rejected.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected the connection to be closed, got %v", err)
+	}
+
+	//closing a connection (even more than once) releases it
+	conn.Close()
+	conn.Close()
+	dial()
+	conn = accept()
+	listener.Lock()
+	count := listener.conns["127.0.0.1"]
+	listener.Unlock()
+	if count != 1 {
+		t.Fatalf("expected 1 connection, got %d", count)
+	}
+	conn.Close()
+	listener.Lock()
+	defer listener.Unlock()
+	if len(listener.conns) != 0 {
+		t.Fatalf("expected no connections to be tracked, got %v", listener.conns)
+	}
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+func TestH2C(t *testing.T) {
+	started, cancelled := make(chan string, 1), make(chan struct{})
+	cfg := newTestConfig(t)
+	cfg.H2C = true
+	handler, _ := newHandler(cfg, http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		started <- request.Proto
+		<-request.Context().Done()
+		close(cancelled)
+	}))
+	testServer := httptest.NewServer(handler)
+	defer testServer.Close()
+
+	//http/2 without tls (prior knowledge)
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, testServer.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errRequest := make(chan error, 1)
+	go func() {
+		response, err := client.Do(request)
+		if err == nil {
+			response.Body.Close()
+		}
+		errRequest <- err
+	}()
+	select {
+	case proto := <-started:
+		if proto != "HTTP/2.0" {
+			t.Fatalf("expected HTTP/2.0, got %s", proto)
+		}
+	case err := <-errRequest:
+		t.Fatalf("unexpected error: %v", err)
+	case <-time.After(time.Second):
+		t.Fatal("expected the request to be started")
+	}
+
+	//cancelling the request resets the stream, which cancels the
+	// context of the handler
+	cancel()
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("expected the stream cancellation to propagate to the handler")
+	}
+	<-errRequest
+}
@@ -0,0 +1,25 @@
+package server
+
+import "net"
+
+// noDelayListener sets TCP_NODELAY on each accepted connection, go
+// enables it by default, so it's only needed to disable it (i.e., to
+// enable nagle's algorithm)
+type noDelayListener struct {
+	net.Listener
+	noDelay bool
+}
+
+func (n *noDelayListener) Accept() (net.Conn, error) {
+	conn, err := n.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		if err := tcpConn.SetNoDelay(n.noDelay); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
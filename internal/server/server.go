@@ -0,0 +1,373 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/antonio-alexander/go-blog-context/internal/config"
+	"github.com/antonio-alexander/go-blog-context/internal/middleware"
+	"github.com/antonio-alexander/go-blog-context/internal/response"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+const (
+	BindDefault string = ""
+	BindIPv4    string = "ipv4"
+	BindIPv6    string = "ipv6"
+	BindDual    string = "dual"
+)
+
+// EnvNames are the environment variables of the lifecycle flags whose
+// name isn't the flag name in upper case
+var EnvNames = map[string]string{
+	"port":    "HTTP_PORT",
+	"address": "HTTP_ADDRESS",
+}
+
+// AdminPaths are the paths of the admin endpoints served alongside the
+// handler, they're probed over plain http (e.g., by the kubelet) so they
+// should be exempt from requiring https
+var AdminPaths = []string{"/inflight", "/readyz", "/config"}
+
+// Config is the configuration of the server lifecycle shared by the
+// applications, application specific configuration (e.g., middleware)
+// is provided by the application
+type Config struct {
+	Address             string
+	Port                string
+	Bind                string
+	WriteTimeout        time.Duration
+	DisableKeepalive    bool
+	ShutdownHardTimeout time.Duration
+	PrestopDelay        time.Duration
+	ShutdownBody        string
+	H2C                 bool
+	TLSSelfSigned       bool
+	TCPNoDelay          bool
+	ListenBacklog       int
+	MaxConnsPerIP       int
+
+	//Middleware is applied to every request (including the admin
+	// endpoints) in order
+	Middleware []middleware.Middleware
+
+	//BaseContext (optional) is the base context of every request
+	BaseContext func(net.Listener) context.Context
+
+	//OnShutdown (optional) is executed once the listeners are closed
+	// when shutting down
+	OnShutdown func()
+
+	//OnStopped (optional) is executed once the server has stopped
+	// serving (before Run returns), its context has the deadline of
+	// the shutdown (e.g., to flush buffers or close resources)
+	OnStopped func(ctx context.Context) error
+
+	//Summary is the application specific configuration written when
+	// the server starts (the lifecycle configuration is added to it)
+	Summary map[string]any
+
+	//Sources (optional) is the source (default, flag or env) of each
+	// setting, it's written with the summary and served by /config
+	Sources map[string]string
+}
+
+// Flags registers the flags of the lifecycle configuration
+func (c *Config) Flags(cli *flag.FlagSet) {
+	cli.StringVar(&c.Address, "address", "", "http address")
+	cli.StringVar(&c.Port, "port", "8080", "http port")
+	cli.StringVar(&c.Bind, "bind", BindDefault, "ip stack to listen on (ipv4, ipv6, dual)")
+	cli.BoolVar(&c.DisableKeepalive, "disable_keepalive", false, "disable http keep-alives (close the connection after each response)")
+	cli.DurationVar(&c.ShutdownHardTimeout, "shutdown_hard_timeout", 30*time.Second, "maximum time to wait for a graceful shutdown before forcing close")
+	cli.DurationVar(&c.PrestopDelay, "prestop_delay", 0, "delay between becoming not ready and shutting down (a second signal skips it)")
+	cli.StringVar(&c.ShutdownBody, "shutdown_body", middleware.DefaultDrainingBody, "json body returned by /readyz when shutting down")
+	cli.BoolVar(&c.TCPNoDelay, "tcp_nodelay", true, "set TCP_NODELAY on accepted connections (false enables nagle's algorithm)")
+	cli.IntVar(&c.ListenBacklog, "listen_backlog", 0, "tcp listen backlog, capped by somaxconn (0 uses somaxconn, linux only)")
+	cli.IntVar(&c.MaxConnsPerIP, "max_conns_per_ip", 0, "maximum concurrent connections from each client ip (0 is unlimited)")
+	cli.BoolVar(&c.TLSSelfSigned, "tls_self_signed", false, "serve tls with an in-memory self signed certificate for localhost")
+}
+
+// Envs overrides the lifecycle configuration with the environment
+func (c *Config) Envs(envs map[string]string) error {
+	var err error
+
+	if _, ok := envs["HTTP_PORT"]; ok {
+		c.Port = envs["HTTP_PORT"]
+	}
+	if _, ok := envs["HTTP_ADDRESS"]; ok {
+		c.Address = envs["HTTP_ADDRESS"]
+	}
+	if _, ok := envs["BIND"]; ok {
+		c.Bind = envs["BIND"]
+	}
+	if _, ok := envs["DISABLE_KEEPALIVE"]; ok {
+		if c.DisableKeepalive, err = strconv.ParseBool(envs["DISABLE_KEEPALIVE"]); err != nil {
+			return err
+		}
+	}
+	if _, ok := envs["SHUTDOWN_HARD_TIMEOUT"]; ok {
+		if c.ShutdownHardTimeout, err = time.ParseDuration(envs["SHUTDOWN_HARD_TIMEOUT"]); err != nil {
+			return err
+		}
+	}
+	if _, ok := envs["PRESTOP_DELAY"]; ok {
+		if c.PrestopDelay, err = time.ParseDuration(envs["PRESTOP_DELAY"]); err != nil {
+			return err
+		}
+	}
+	if _, ok := envs["SHUTDOWN_BODY"]; ok {
+		c.ShutdownBody = envs["SHUTDOWN_BODY"]
+	}
+	if _, ok := envs["TLS_SELF_SIGNED"]; ok {
+		if c.TLSSelfSigned, err = strconv.ParseBool(envs["TLS_SELF_SIGNED"]); err != nil {
+			return err
+		}
+	}
+	if _, ok := envs["TCP_NODELAY"]; ok {
+		if c.TCPNoDelay, err = strconv.ParseBool(envs["TCP_NODELAY"]); err != nil {
+			return err
+		}
+	}
+	if _, ok := envs["LISTEN_BACKLOG"]; ok {
+		if c.ListenBacklog, err = strconv.Atoi(envs["LISTEN_BACKLOG"]); err != nil {
+			return err
+		}
+	}
+	if _, ok := envs["MAX_CONNS_PER_IP"]; ok {
+		if c.MaxConnsPerIP, err = strconv.Atoi(envs["MAX_CONNS_PER_IP"]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listen creates the listener for the ip stack, ipv4 and ipv6 only listen
+// on their stack (the unspecified address is used if the address is empty)
+// while dual listens on both (using the ipv6 unspecified address); by
+// default the address is used as is
+func listen(bind, address, port string) (net.Listener, error) {
+	switch bind {
+	default:
+		return nil, fmt.Errorf("unsupported bind: %s", bind)
+	case BindDefault:
+		return net.Listen("tcp", net.JoinHostPort(address, port))
+	case BindIPv4:
+		if address == "" {
+			address = net.IPv4zero.String()
+		}
+		return net.Listen("tcp4", net.JoinHostPort(address, port))
+	case BindIPv6:
+		if address == "" {
+			address = net.IPv6unspecified.String()
+		}
+		return net.Listen("tcp6", net.JoinHostPort(address, port))
+	case BindDual:
+		if address == "" {
+			address = net.IPv6unspecified.String()
+		}
+		return net.Listen("tcp", net.JoinHostPort(address, port))
+	}
+}
+
+// shutdown will attempt to gracefully shutdown the server, if it doesn't
+// complete before the context's deadline (the hard timeout), the server
+// is forcibly closed and an error wrapping context.DeadlineExceeded is
+// returned
+func shutdown(ctx context.Context, server *http.Server, hardTimeout time.Duration) error {
+	err := server.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return errors.Join(fmt.Errorf("graceful shutdown exceeded %v, forcing close: %w", hardTimeout, err),
+		server.Close())
+}
+
+// summary returns the lifecycle configuration along with the application
+// specific configuration
+func (c Config) summary() map[string]any {
+	summary := map[string]any{
+		"address":               c.Address,
+		"port":                  c.Port,
+		"bind":                  c.Bind,
+		"tls":                   c.TLSSelfSigned,
+		"write_timeout":         c.WriteTimeout.String(),
+		"disable_keepalive":     c.DisableKeepalive,
+		"shutdown_hard_timeout": c.ShutdownHardTimeout.String(),
+		"prestop_delay":         c.PrestopDelay.String(),
+		"shutdown_body":         c.ShutdownBody,
+		"h2c":                   c.H2C,
+		"tcp_nodelay":           c.TCPNoDelay,
+		"listen_backlog":        c.ListenBacklog,
+		"max_conns_per_ip":      c.MaxConnsPerIP,
+	}
+	for key, value := range c.Summary {
+		summary[key] = value
+	}
+	return summary
+}
+
+// newHandler serves the admin endpoints (/inflight, /readyz and /config)
+// alongside the handler and applies the middleware, the readiness is
+// returned so the server can become not ready when shutting down
+func newHandler(cfg Config, handler http.Handler) (http.Handler, *middleware.Readiness) {
+	//admin endpoints are served by their own mux so they aren't
+	// counted as in-flight requests
+	inflight := &middleware.InFlight{}
+	readiness := middleware.NewReadiness(cfg.ShutdownBody)
+	summary := cfg.summary()
+	adminMux := http.NewServeMux()
+	adminMux.HandleFunc("/inflight", inflight.Handler)
+	adminMux.HandleFunc("/readyz", readiness.Handler)
+	adminMux.HandleFunc("/config", func(writer http.ResponseWriter, request *http.Request) {
+		if err := response.NewEncoder(writer, request).Encode(map[string]any{
+			"config":  summary,
+			"sources": cfg.Sources,
+		}); err != nil {
+			fmt.Printf("error: %s\n", err.Error())
+		}
+	})
+	adminMux.Handle("/", inflight.Middleware(handler))
+	handler = middleware.Chain(adminMux, cfg.Middleware...)
+	if cfg.H2C {
+		//http/2 without tls, each request is a stream so a client can
+		// cancel a request (RST_STREAM) without closing the connection
+		handler = h2c.NewHandler(handler, &http2.Server{})
+	}
+	return handler, readiness
+}
+
+// Handler returns the handler served by Run (the handler and the admin
+// endpoints with the middleware applied) without a listener, so the
+// whole server can be tested in memory
+func Handler(cfg Config, handler http.Handler) (http.Handler, error) {
+	if !json.Valid([]byte(cfg.ShutdownBody)) {
+		return nil, fmt.Errorf("shutdown body isn't valid json: %s", cfg.ShutdownBody)
+	}
+	handler, _ = newHandler(cfg, handler)
+	return handler, nil
+}
+
+// Run serves the handler until a signal is received (or the server fails
+// to serve), once a signal is received, the server becomes not ready and
+// is gracefully shutdown. The admin endpoints (/inflight, /readyz and
+// /config) are served alongside the handler
+func Run(cfg Config, handler http.Handler, osSignal chan os.Signal) error {
+	var errServe, errShutdown, errStopped error
+	var wg sync.WaitGroup
+	var ctxStop context.Context
+
+	if !json.Valid([]byte(cfg.ShutdownBody)) {
+		return fmt.Errorf("shutdown body isn't valid json: %s", cfg.ShutdownBody)
+	}
+	handler, readiness := newHandler(cfg, handler)
+	server := &http.Server{
+		Addr:         cfg.Address + ":" + cfg.Port,
+		Handler:      handler,
+		WriteTimeout: cfg.WriteTimeout,
+		BaseContext:  cfg.BaseContext,
+	}
+	server.SetKeepAlivesEnabled(!cfg.DisableKeepalive)
+	if cfg.TLSSelfSigned {
+		certificate, err := selfSignedCertificate()
+		if err != nil {
+			return err
+		}
+		server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{certificate}}
+	}
+	if cfg.OnShutdown != nil {
+		server.RegisterOnShutdown(cfg.OnShutdown)
+	}
+	//the listener is created before any signal is handled, so a bind
+	// error is returned even if a signal has already been received
+	listener, err := listen(cfg.Bind, cfg.Address, cfg.Port)
+	if err != nil {
+		return err
+	}
+	if cfg.ListenBacklog > 0 {
+		if err := setListenBacklog(listener, cfg.ListenBacklog); err != nil {
+			listener.Close()
+			return err
+		}
+	}
+	if !cfg.TCPNoDelay {
+		listener = &noDelayListener{Listener: listener, noDelay: cfg.TCPNoDelay}
+	}
+	if cfg.MaxConnsPerIP > 0 {
+		listener = newConnLimitListener(listener, cfg.MaxConnsPerIP)
+	}
+	fmt.Printf("starting web server on %s\n", listener.Addr())
+	if err := config.WriteSummary(os.Stdout, cfg.summary(), cfg.Sources); err != nil {
+		fmt.Printf("error: %s\n", err.Error())
+	}
+	stopped := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(stopped)
+
+		serve := server.Serve
+		if cfg.TLSSelfSigned {
+			//the certificate is provided by the tls configuration
+			serve = func(listener net.Listener) error {
+				return server.ServeTLS(listener, "", "")
+			}
+		}
+		if err := serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errServe = err
+		}
+	}()
+	select {
+	case <-stopped:
+	case <-osSignal:
+		//if the server stopped (nearly) when the signal was received,
+		// select chooses at random; so the server stopping is checked
+		// again to give its error precedence over a (clean) shutdown
+		select {
+		case <-stopped:
+		default:
+			//become not ready and give load balancers time to stop routing
+			// requests before shutting down, a second signal skips the delay
+			readiness.NotReady()
+			if cfg.PrestopDelay > 0 {
+				fmt.Printf("waiting %v before shutting down\n", cfg.PrestopDelay)
+				select {
+				case <-time.After(cfg.PrestopDelay):
+				case <-stopped:
+				case <-osSignal:
+				}
+			}
+			var cancel context.CancelFunc
+			ctxStop, cancel = context.WithTimeout(context.Background(), cfg.ShutdownHardTimeout)
+			defer cancel()
+			errShutdown = shutdown(ctxStop, server, cfg.ShutdownHardTimeout)
+		}
+	}
+	wg.Wait()
+	if cfg.OnStopped != nil {
+		//if the server stopped on its own (i.e., it wasn't shutdown)
+		// the hook is given the hard timeout
+		if ctxStop == nil {
+			var cancel context.CancelFunc
+			ctxStop, cancel = context.WithTimeout(context.Background(), cfg.ShutdownHardTimeout)
+			defer cancel()
+		}
+		errStopped = cfg.OnStopped(ctxStop)
+	}
+
+	//aggregate the errors that occurred while serving and shutting
+	// down so none of them are lost, the error that occurred while
+	// serving (e.g., the listener failing) is always first
+	return errors.Join(errServe, errShutdown, errStopped)
+}
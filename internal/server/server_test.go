@@ -0,0 +1,326 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// newTestConfig returns the default configuration (listening on a
+// random loopback port) with the args applied
+func newTestConfig(t *testing.T, args ...string) Config {
+	t.Helper()
+
+	var cfg Config
+	cli := flag.NewFlagSet("", flag.ContinueOnError)
+	cfg.Flags(cli)
+	if err := cli.Parse(append([]string{"-address", "127.0.0.1", "-port", "0"}, args...)); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestRunOnStopped(t *testing.T) {
+	var calls int
+	var deadline time.Time
+
+	cfg := newTestConfig(t, "-shutdown_hard_timeout", "5s")
+	errStopped := errors.New("stopped")
+	cfg.OnStopped = func(ctx context.Context) error {
+		calls++
+		deadline, _ = ctx.Deadline()
+		return errStopped
+	}
+	osSignal := make(chan os.Signal, 1)
+	osSignal <- syscall.SIGINT
+	err := Run(cfg, http.NotFoundHandler(), osSignal)
+	if !errors.Is(err, errStopped) {
+		t.Fatalf("expected %v, got %v", errStopped, err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected 1 call, got %d", calls)
+	}
+	if remaining := time.Until(deadline); remaining <= 0 || remaining > 5*time.Second {
+		t.Fatalf("expected the shutdown deadline, %v remaining", remaining)
+	}
+}
+
+func TestStoppedHardTimeout(t *testing.T) {
+	//the handler refuses to return, so the graceful shutdown can't
+	// complete and the server must be forcibly closed
+	started, release := make(chan struct{}), make(chan struct{})
+	testServer := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		close(started)
+		<-release
+	}))
+	defer testServer.Close()
+	defer close(release)
+	errRequest := make(chan error, 1)
+	go func() {
+		response, err := http.Get(testServer.URL)
+		if err == nil {
+			response.Body.Close()
+		}
+		errRequest <- err
+	}()
+	<-started
+
+	hardTimeout := 100 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), hardTimeout)
+	defer cancel()
+	tStart := time.Now()
+	err := shutdown(ctx, testServer.Config, hardTimeout)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if elapsed := time.Since(tStart); elapsed > time.Second {
+		t.Fatalf("expected shutdown to be forced after %v, took %v", hardTimeout, elapsed)
+	}
+	select {
+	case err := <-errRequest:
+		if err == nil {
+			t.Fatal("expected the connection to be closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the connection to be closed")
+	}
+}
+
+func TestRunBindErrorWins(t *testing.T) {
+	//the port is in use and a signal has already been received, the
+	// bind error must be returned rather than a clean shutdown
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	osSignal := make(chan os.Signal, 1)
+	osSignal <- syscall.SIGINT
+	err = Run(newTestConfig(t, "-port", port), http.NotFoundHandler(), osSignal)
+	var opError *net.OpError
+	if !errors.As(err, &opError) || opError.Op != "listen" {
+		t.Fatalf("expected a listen error, got %v", err)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	handler, err := Handler(newTestConfig(t), http.HandlerFunc(func(writer http.ResponseWriter, _ *http.Request) {
+		writer.WriteHeader(http.StatusTeapot)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, statusCode := range map[string]int{
+		"/":         http.StatusTeapot,
+		"/inflight": http.StatusOK,
+		"/readyz":   http.StatusOK,
+		"/config":   http.StatusOK,
+	} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		if recorder.Code != statusCode {
+			t.Fatalf("%s: expected %d, got %d", path, statusCode, recorder.Code)
+		}
+	}
+	if _, err := Handler(newTestConfig(t, "-shutdown_body", "{"), http.NotFoundHandler()); err == nil {
+		t.Fatal("expected an error for an invalid shutdown body")
+	}
+}
+
+// freePort returns a loopback port that's free (at the time it's called)
+func freePort(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return port
+}
+
+func TestRunJoinsErrors(t *testing.T) {
+	//the graceful shutdown fails (a handler refuses to return) and so
+	// does the stopped hook, both errors must be returned
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	port := freePort(t)
+	cfg := newTestConfig(t, "-port", port, "-shutdown_hard_timeout", "100ms")
+	errStopped := errors.New("stopped")
+	cfg.OnStopped = func(context.Context) error { return errStopped }
+	osSignal, errRun := make(chan os.Signal, 1), make(chan error, 1)
+	go func() {
+		errRun <- Run(cfg, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+			close(started)
+			<-release
+		}), osSignal)
+	}()
+	go func() {
+		//the server may not be listening yet
+		for {
+			response, err := http.Get("http://127.0.0.1:" + port)
+			if err == nil {
+				response.Body.Close()
+				return
+			}
+			select {
+			case <-started:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the handler to be started")
+	}
+	osSignal <- syscall.SIGINT
+	err := <-errRun
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the shutdown error, got %v", err)
+	}
+	if !errors.Is(err, errStopped) {
+		t.Fatalf("expected the stopped error, got %v", err)
+	}
+}
+
+// startRun runs the server (in the background) until the test is done,
+// it returns the url of the server once it's serving
+func startRun(t *testing.T, handler http.Handler, args ...string) string {
+	t.Helper()
+
+	port := freePort(t)
+	url := "http://127.0.0.1:" + port
+	osSignal, errRun := make(chan os.Signal, 1), make(chan error, 1)
+	go func() {
+		errRun <- Run(newTestConfig(t, append([]string{"-port", port}, args...)...), handler, osSignal)
+	}()
+	t.Cleanup(func() {
+		osSignal <- syscall.SIGINT
+		if err := <-errRun; err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+	})
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	for tStart := time.Now(); time.Since(tStart) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		response, err := client.Get(url + "/readyz")
+		if err != nil {
+			continue
+		}
+		response.Body.Close()
+		return url
+	}
+	t.Fatalf("%s isn't serving", url)
+	return ""
+}
+
+func TestRunDisableKeepalive(t *testing.T) {
+	for args, close := range map[string]bool{
+		"":                        false,
+		"-disable_keepalive=true": true,
+	} {
+		url := startRun(t, http.NotFoundHandler(), strings.Fields(args)...)
+		transport := &http.Transport{}
+		defer transport.CloseIdleConnections()
+		response, err := (&http.Client{Transport: transport}).Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		if response.Close != close {
+			t.Fatalf("%q: expected Connection: close to be %t", args, close)
+		}
+	}
+}
+
+func TestRunPrestopDelay(t *testing.T) {
+	const prestopDelay time.Duration = 300 * time.Millisecond
+
+	//the delay elapses before shutting down unless a second signal
+	// is received (which skips it)
+	for _, signals := range []int{1, 2} {
+		cfg := newTestConfig(t, "-prestop_delay", prestopDelay.String())
+		osSignal, errRun := make(chan os.Signal, 1), make(chan error, 1)
+		var tStopped time.Time
+		cfg.OnStopped = func(context.Context) error {
+			tStopped = time.Now()
+			return nil
+		}
+		osSignal <- syscall.SIGINT
+		tStart := time.Now()
+		go func() {
+			errRun <- Run(cfg, http.NotFoundHandler(), osSignal)
+		}()
+		if signals > 1 {
+			osSignal <- syscall.SIGINT
+		}
+		if err := <-errRun; err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		elapsed := tStopped.Sub(tStart)
+		if signals == 1 && elapsed < prestopDelay {
+			t.Fatalf("expected the delay to elapse before shutting down, stopped after %v", elapsed)
+		}
+		if signals > 1 && elapsed >= prestopDelay {
+			t.Fatalf("expected the second signal to skip the delay, stopped after %v", elapsed)
+		}
+	}
+}
+
+func TestListenBind(t *testing.T) {
+	//ipv6 (and so dual stack) isn't available everywhere
+	ipv6 := true
+	if listener, err := net.Listen("tcp6", "[::1]:0"); err != nil {
+		ipv6 = false
+	} else {
+		listener.Close()
+	}
+	for _, c := range []struct {
+		bind   string
+		ipv4   bool
+		ipv6   bool
+		dialed string
+	}{
+		{BindIPv4, true, false, "127.0.0.1"},
+		{BindIPv6, false, true, "::1"},
+		{BindDual, false, true, "127.0.0.1"},
+	} {
+		if c.ipv6 && !ipv6 {
+			t.Logf("%s: ipv6 isn't available", c.bind)
+			continue
+		}
+		listener, err := listen(c.bind, "", "0")
+		if err != nil {
+			t.Fatalf("%s: %s", c.bind, err)
+		}
+		defer listener.Close()
+		addr := listener.Addr().(*net.TCPAddr)
+		if isIPv4 := addr.IP.To4() != nil; isIPv4 != c.ipv4 {
+			t.Fatalf("%s: unexpected address %s", c.bind, addr)
+		}
+		//dual stack accepts ipv4 connections on the ipv6 listener
+		conn, err := net.Dial("tcp", net.JoinHostPort(c.dialed, strconv.Itoa(addr.Port)))
+		if err != nil {
+			t.Fatalf("%s: %s", c.bind, err)
+		}
+		conn.Close()
+	}
+	if _, err := listen("ipv5", "", "0"); err == nil {
+		t.Fatal("expected an error for an unsupported bind")
+	}
+}
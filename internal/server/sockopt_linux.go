@@ -0,0 +1,31 @@
+//go:build linux
+
+package server
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// setListenBacklog sets the backlog of the (listening) socket, go uses
+// the system maximum (somaxconn) when listening; on linux, listening on
+// a socket that's already listening updates its backlog (it's still
+// capped by somaxconn)
+func setListenBacklog(listener net.Listener, backlog int) error {
+	tcpListener, ok := listener.(*net.TCPListener)
+	if !ok {
+		return errors.New("listen backlog requires a tcp listener")
+	}
+	rawConn, err := tcpListener.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var errListen error
+	if err := rawConn.Control(func(fd uintptr) {
+		errListen = syscall.Listen(int(fd), backlog)
+	}); err != nil {
+		return err
+	}
+	return errListen
+}
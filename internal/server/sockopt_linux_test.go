@@ -0,0 +1,101 @@
+//go:build linux
+
+package server
+
+import (
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+)
+
+// tcpNoDelay returns the TCP_NODELAY option of the connection
+func tcpNoDelay(t *testing.T, conn net.Conn) bool {
+	t.Helper()
+
+	rawConn, err := conn.(*net.TCPConn).SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var value int
+	var errOpt error
+	if err := rawConn.Control(func(fd uintptr) {
+		value, errOpt = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_NODELAY)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if errOpt != nil {
+		t.Fatal(errOpt)
+	}
+	return value != 0
+}
+
+func TestNoDelayListener(t *testing.T) {
+	for _, noDelay := range []bool{true, false} {
+		tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tcpListener.Close()
+		listener := &noDelayListener{Listener: tcpListener, noDelay: noDelay}
+		client, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+		conn, err := listener.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		if value := tcpNoDelay(t, conn); value != noDelay {
+			t.Fatalf("expected TCP_NODELAY to be %t, got %t", noDelay, value)
+		}
+	}
+}
+
+func TestSetListenBacklog(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	if err := setListenBacklog(listener, 16); err != nil {
+		t.Fatal(err)
+	}
+	//the listener still accepts connections once its backlog is set
+	client, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	unixListener, err := net.Listen("unix", t.TempDir()+"/socket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unixListener.Close()
+	if err := setListenBacklog(unixListener, 16); err == nil {
+		t.Fatal("expected an error for a non tcp listener")
+	}
+}
+
+func TestRunSocketOptions(t *testing.T) {
+	//the listener is created with the backlog and nagle's algorithm
+	// enabled and still serves requests
+	url := startRun(t, http.NotFoundHandler(), "-listen_backlog", "16", "-tcp_nodelay=false")
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	response, err := client.Get(url + "/readyz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, response.StatusCode)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package server
+
+import (
+	"errors"
+	"net"
+)
+
+// setListenBacklog isn't supported on this platform
+func setListenBacklog(net.Listener, int) error {
+	return errors.New("listen backlog is only supported on linux")
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/tls"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunTLSSelfSigned(t *testing.T) {
+	url := strings.Replace(startRun(t, http.NotFoundHandler(), "-tls_self_signed"), "http://", "https://", 1)
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		DisableKeepAlives: true,
+	}}
+	response, err := client.Get(url + "/readyz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, response.StatusCode)
+	}
+	certificate := response.TLS.PeerCertificates[0]
+	if _, ok := certificate.PublicKey.(*ecdsa.PublicKey); !ok {
+		t.Fatalf("expected an ecdsa certificate, got %T", certificate.PublicKey)
+	}
+	for _, host := range []string{"localhost", "127.0.0.1"} {
+		if err := certificate.VerifyHostname(host); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if validity := certificate.NotAfter.Sub(certificate.NotBefore); validity > selfSignedValidity+time.Minute {
+		t.Fatalf("expected a short validity, got %v", validity)
+	}
+}